@@ -34,7 +34,10 @@ func testbig() {
 		hasher.Write([]byte(strings.Repeat(strconv.Itoa(i), 4)))
 		trie.Insert(hasher.Sum(nil), &indexer.Item{Pos: uint64(i), Length: uint64(i)})
 	}
-	trie.SaveToFile(filename)
+	if err := trie.SaveToFile(filename); err != nil {
+		fmt.Printf("save error: %v\n", err)
+		return
+	}
 
 }
 
@@ -53,7 +56,10 @@ func testFile() {
 	for _, item := range items {
 		trie.Insert(item.Prefix, item.Item)
 	}
-	trie.SaveToFile(filename)
+	if err := trie.SaveToFile(filename); err != nil {
+		fmt.Printf("save error: %v\n", err)
+		return
+	}
 
 	trie2 := indexer.NewTrie()
 	trie2.ReadFromFile(filename)
@@ -180,7 +186,17 @@ func testFunc() {
 		fmt.Printf("Marshal error: %v\n", err)
 		return
 	}
-	fmt.Printf("json marshal: %v, size: %d \n", ss, len(ss))
+	fmt.Printf("json marshal: %s, size: %d \n", ss, len(ss))
+
+	t2 := indexer.NewTrie()
+	if err = json.Unmarshal(ss, t2); err != nil {
+		fmt.Printf("Unmarshal error: %v\n", err)
+		return
+	}
+	fmt.Printf("json unmarshal: %d items\n", t2.Size())
+
+	// Render the node structure for Graphviz.
+	trie.WriteDOT(os.Stdout)
 	// Walk prefixes.
 	prefix := []byte("0x111222333")
 	trie.VisitPrefixes(prefix, printItem)
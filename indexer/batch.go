@@ -0,0 +1,277 @@
+package indexer
+
+import (
+	"bytes"
+	"sort"
+)
+
+// BatchOf records modifications of a trie and applies them all at once with
+// Commit, or drops them with Rollback. The trie is not touched before Commit,
+// and Commit either applies the whole batch or leaves the trie as it was.
+//
+// The operations behave as if they were applied to the trie one by one in the
+// order they were recorded. A batch is not thread-safe and can be reused once
+// committed or rolled back.
+type BatchOf[V any] struct {
+	trie *TrieOf[V]
+	ops  []batchOp[V]
+	err  error
+}
+
+// Batch is the Item based instantiation of BatchOf.
+type Batch = BatchOf[Item]
+
+type batchOpKind uint8
+
+const (
+	batchInsert batchOpKind = iota
+	batchSet
+	batchDelete
+	batchDeleteSubtree
+)
+
+type batchOp[V any] struct {
+	kind batchOpKind
+	key  []byte
+	item *V
+}
+
+// NewBatch returns an empty batch of modifications of the trie.
+func (trie *TrieOf[V]) NewBatch() *BatchOf[V] {
+	return &BatchOf[V]{trie: trie}
+}
+
+// Insert records inserting item under key unless the key holds an item.
+func (b *BatchOf[V]) Insert(key []byte, item *V) {
+	b.record(batchInsert, key, item)
+}
+
+// Set records storing item under key, replacing the item held there.
+func (b *BatchOf[V]) Set(key []byte, item *V) {
+	b.record(batchSet, key, item)
+}
+
+// Delete records deleting the item stored under key.
+func (b *BatchOf[V]) Delete(key []byte) {
+	b.record(batchDelete, key, nil)
+}
+
+// DeleteSubtree records deleting all items whose keys start with prefix.
+func (b *BatchOf[V]) DeleteSubtree(prefix []byte) {
+	b.record(batchDeleteSubtree, prefix, nil)
+}
+
+// Len returns the number of recorded operations.
+func (b *BatchOf[V]) Len() int {
+	return len(b.ops)
+}
+
+// record validates and records an operation. The first invalid one makes
+// Commit fail.
+func (b *BatchOf[V]) record(kind batchOpKind, key []byte, item *V) {
+	switch {
+	case b.err != nil:
+		return
+	case key == nil:
+		b.err = ErrNilPrefix
+	case item == nil && (kind == batchInsert || kind == batchSet):
+		b.err = ErrNilItem
+	}
+	b.ops = append(b.ops, batchOp[V]{kind: kind, key: key, item: item})
+}
+
+// Rollback drops the recorded operations.
+func (b *BatchOf[V]) Rollback() {
+	b.ops = nil
+	b.err = nil
+}
+
+// Commit applies the recorded operations to the trie. When an operation is
+// invalid it returns its error and the trie is left untouched. Either way the
+// batch is empty afterwards.
+//
+// The operations are sorted by key and applied in a single pass over a copy
+// of the modified paths, which replaces the trie at the end. Every node on
+// the modified paths is visited and copied once however many keys below it
+// change, the shared prefixes of the keys are not walked again per key.
+func (b *BatchOf[V]) Commit() error {
+	defer b.Rollback()
+	if b.err != nil {
+		return b.err
+	}
+	if len(b.ops) == 0 {
+		return nil
+	}
+
+	work := b.trie.shallowClone()
+	if work.Prefix == nil {
+		// A nil prefix marks the empty trie, the root may get children.
+		work.Prefix = []byte{}
+	}
+	work.apply(b.collapse(), 0)
+	if work.Empty() {
+		work.reset()
+	}
+
+	*b.trie = *work
+	return nil
+}
+
+// collapse reduces the operations to the subtrees to delete and the last
+// operation of every key, which have the same effect as the operations in the
+// recorded order. They are sorted by key, a subtree delete coming before the
+// other operation on its prefix.
+func (b *BatchOf[V]) collapse() []batchOp[V] {
+	var (
+		subtrees []batchOp[V]
+		last     = make(map[string]batchOp[V])
+	)
+	deleted := func(key []byte) bool {
+		for _, op := range subtrees {
+			if bytes.HasPrefix(key, op.key) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, op := range b.ops {
+		switch op.kind {
+		case batchInsert:
+			if prev, ok := last[string(op.key)]; ok {
+				if prev.kind != batchDelete {
+					// The key holds an item, Insert does nothing.
+					continue
+				}
+				op.kind = batchSet
+			} else if deleted(op.key) {
+				op.kind = batchSet
+			}
+		case batchDeleteSubtree:
+			for key := range last {
+				if bytes.HasPrefix([]byte(key), op.key) {
+					delete(last, key)
+				}
+			}
+			subtrees = append(subtrees, op)
+			continue
+		}
+		last[string(op.key)] = op
+	}
+
+	ops := subtrees
+	for _, op := range last {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if c := bytes.Compare(ops[i].key, ops[j].key); c != 0 {
+			return c < 0
+		}
+		return ops[i].kind == batchDeleteSubtree && ops[j].kind != batchDeleteSubtree
+	})
+	return ops
+}
+
+// apply applies ops, collapsed and sorted by key, to the node, which must not
+// be shared with other tries. The first depth bytes of every key lead to the
+// node. The children on the paths of the keys are copied and the operations
+// below each of them are applied to the copy in turn, so every node is
+// visited once. The node may be left empty, then its parent drops it.
+func (trie *TrieOf[V]) apply(ops []batchOp[V], depth int) {
+	trie.invalidate()
+
+	// A subtree delete covering the node drops all of its items, the
+	// operations after it in key order apply to the emptied node. Find where
+	// the prefix must be split to hold the new keys.
+	split := len(trie.Prefix)
+	for _, op := range ops {
+		rest := op.key[depth:]
+		common := trie.longestCommonPrefixLength(rest)
+		switch {
+		case op.kind == batchDeleteSubtree && common == len(rest):
+			trie.Item = nil
+			trie.Children = newSparseChildList[V](trie.maxSparse())
+			trie.count = 0
+		case (op.kind == batchInsert || op.kind == batchSet) && common < split:
+			split = common
+		}
+	}
+
+	if split < len(trie.Prefix) {
+		if trie.Empty() {
+			trie.Prefix = trie.Prefix[:split]
+		} else {
+			child := new(TrieOf[V])
+			*child = *trie
+			*trie = *trie.newNode()
+			trie.Prefix = child.Prefix[:split]
+			child.Prefix = child.Prefix[split:]
+			trie.Children = trie.Children.add(child.compact())
+			trie.count = child.count
+		}
+	}
+
+	// The keys below the node follow each other. The others are applied
+	// already or delete keys that are not in the trie.
+	for len(ops) != 0 && !bytes.HasPrefix(ops[0].key[depth:], trie.Prefix) {
+		ops = ops[1:]
+	}
+	for len(ops) != 0 && !bytes.HasPrefix(ops[len(ops)-1].key[depth:], trie.Prefix) {
+		ops = ops[:len(ops)-1]
+	}
+
+	depth += len(trie.Prefix)
+	for i := 0; i < len(ops); {
+		op := ops[i]
+		if len(op.key) == depth {
+			switch {
+			case op.kind == batchInsert && trie.Item == nil, op.kind == batchSet:
+				if trie.Item == nil {
+					trie.count++
+				}
+				trie.Item = op.item
+			case op.kind == batchDelete && trie.Item != nil:
+				trie.Item = nil
+				trie.count--
+			}
+			i++
+			continue
+		}
+
+		// The operations below the same child follow each other.
+		b := op.key[depth]
+		j := i + 1
+		for j < len(ops) && len(ops[j].key) > depth && ops[j].key[depth] == b {
+			j++
+		}
+
+		if child := trie.Children.next(b); child != nil {
+			trie.count -= child.count
+			child = child.shallowClone()
+			child.apply(ops[i:j], depth)
+			if child.Empty() {
+				trie.Children = trie.Children.remove(b)
+			} else {
+				trie.Children.replace(b, child)
+				trie.count += child.count
+			}
+		} else {
+			end := depth + trie.maxPrefix()
+			if end > len(op.key) {
+				end = len(op.key)
+			}
+			child = trie.newNode()
+			child.Prefix = op.key[depth:end]
+			child.apply(ops[i:j], depth)
+			if !child.Empty() {
+				trie.Children = trie.Children.add(child)
+				trie.count += child.count
+			}
+		}
+		i = j
+	}
+
+	if compacted := trie.compact(); compacted != trie {
+		*trie = *compacted
+	}
+}
@@ -0,0 +1,166 @@
+package indexer
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// randomBatch records n random operations on keys sharing prefixes into b and
+// applies them to want one by one.
+func randomBatch(rnd *rand.Rand, b *Batch, want *Trie, n int) {
+	for i := 0; i < n; i++ {
+		key := make([]byte, rnd.Intn(6))
+		for j := range key {
+			key[j] = 'a' + byte(rnd.Intn(4))
+		}
+		item := &Item{Pos: uint64(i)}
+		switch rnd.Intn(8) {
+		case 0, 1, 2:
+			b.Insert(key, item)
+			want.Insert(key, item)
+		case 3, 4, 5:
+			b.Set(key, item)
+			want.Set(key, item)
+		case 6:
+			b.Delete(key)
+			want.Delete(key)
+		case 7:
+			b.DeleteSubtree(key)
+			want.DeleteSubtree(key)
+		}
+	}
+}
+
+func TestBatchCommit(t *testing.T) {
+	rnd := rand.New(rand.NewSource(23))
+	for round := 0; round < 200; round++ {
+		var opts []Option
+		if round%2 != 0 {
+			opts = append(opts, WithMaxPrefixPerNode(2), WithMaxChildrenPerSparseNode(2))
+		}
+		trie, want := NewTrie(opts...), NewTrie(opts...)
+		for i := 0; i < 3; i++ {
+			before := *trie
+			var items []*Item
+			before.Walk(nil, func(key []byte, item *Item) error {
+				items = append(items, item)
+				return nil
+			})
+
+			b := trie.NewBatch()
+			randomBatch(rnd, b, want, 1+rnd.Intn(60))
+			if err := b.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			if b.Len() != 0 {
+				t.Fatalf("%d operations left after commit", b.Len())
+			}
+			assertSameItems(t, want, trie)
+
+			// The nodes of the previous version are shared, not modified.
+			i := 0
+			before.Walk(nil, func(key []byte, item *Item) error {
+				if i >= len(items) || items[i] != item {
+					t.Fatalf("round %d: previous version changed at %q", round, key)
+				}
+				i++
+				return nil
+			})
+			if i != len(items) {
+				t.Fatalf("round %d: previous version holds %d items, want %d", round, i, len(items))
+			}
+		}
+	}
+}
+
+func TestBatchInvalid(t *testing.T) {
+	trie := newHashTrie(100)
+	want := trie.Dump()
+
+	cases := map[string]struct {
+		record func(b *Batch)
+		err    error
+	}{
+		"nil key":    {func(b *Batch) { b.Set(nil, &Item{}) }, ErrNilPrefix},
+		"nil item":   {func(b *Batch) { b.Insert([]byte("x"), nil) }, ErrNilItem},
+		"nil prefix": {func(b *Batch) { b.DeleteSubtree(nil) }, ErrNilPrefix},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			b := trie.NewBatch()
+			b.Set([]byte("a"), &Item{})
+			b.DeleteSubtree([]byte{})
+			c.record(b)
+			b.Set([]byte("b"), &Item{})
+			if err := b.Commit(); !errors.Is(err, c.err) {
+				t.Fatalf("want %v, got %v", c.err, err)
+			}
+			if trie.Dump() != want {
+				t.Fatal("failed commit modified the trie")
+			}
+
+			// The batch is usable again.
+			b.Set([]byte("c"), &Item{})
+			if err := b.Commit(); err != nil || trie.Get([]byte("c")) == nil {
+				t.Fatalf("commit after failure: %v", err)
+			}
+			trie.Delete([]byte("c"))
+		})
+	}
+}
+
+func TestBatchRollback(t *testing.T) {
+	trie := newHashTrie(100)
+	want := trie.Dump()
+
+	b := trie.NewBatch()
+	b.DeleteSubtree([]byte{})
+	b.Set([]byte("a"), &Item{})
+	b.Rollback()
+	if b.Len() != 0 || trie.Dump() != want {
+		t.Fatal("rollback left operations or modified the trie")
+	}
+	if err := b.Commit(); err != nil || trie.Dump() != want {
+		t.Fatalf("empty commit: %v", err)
+	}
+}
+
+func BenchmarkBatchCommit(b *testing.B) {
+	rnd := rand.New(rand.NewSource(23))
+	random := make([][]byte, 1000)
+	for i := range random {
+		random[i] = make([]byte, 32)
+		rnd.Read(random[i])
+	}
+	// Keys of a single range share long paths.
+	sequential := make([][]byte, 1000)
+	for i := range sequential {
+		sequential[i] = make([]byte, 32)
+		copy(sequential[i], random[0])
+		binary.BigEndian.PutUint64(sequential[i][24:], uint64(i))
+	}
+
+	for _, bench := range []struct {
+		name string
+		keys [][]byte
+	}{
+		{"random", random},
+		{"sequential", sequential},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			trie := newHashTrie(100000)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				batch := trie.NewBatch()
+				for _, key := range bench.keys {
+					batch.Set(key, &Item{Pos: uint64(i)})
+				}
+				if err := batch.Commit(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package indexer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// BuilderOf constructs a trie from keys added in strictly ascending order,
+// such as the records of a serialized trie. Unlike Insert it never searches
+// the trie from the root: only the path to the last added key is kept open,
+// so building takes time linear in the total length of the keys.
+//
+// The result has the same shape as inserting the keys in ascending order.
+type BuilderOf[V any] struct {
+	trie  *TrieOf[V]
+	stack []builderFrame[V]
+	prev  []byte
+}
+
+// Builder is the Item based instantiation of BuilderOf.
+type Builder = BuilderOf[Item]
+
+// builderFrame is a node on the path to the last added key.
+type builderFrame[V any] struct {
+	node *TrieOf[V]
+	end  int // length of the key up to and including the node prefix
+}
+
+// NewBuilder returns a Builder of an empty Trie created with opts.
+func NewBuilder(opts ...Option) *Builder {
+	return NewBuilderOf[Item](ItemCodec{}, opts...)
+}
+
+// NewBuilderOf returns a builder of an empty trie for values of type V,
+// serialized with codec.
+func NewBuilderOf[V any](codec ValueCodec[V], opts ...Option) *BuilderOf[V] {
+	return newBuilder(NewTrieOf[V](codec, opts...))
+}
+
+// newBuilder returns a builder filling trie, which must be empty.
+func newBuilder[V any](trie *TrieOf[V]) *BuilderOf[V] {
+	return &BuilderOf[V]{trie: trie}
+}
+
+// Add adds item under key, which must be greater than all keys added before.
+// Like Insert, the trie keeps referencing key.
+func (b *BuilderOf[V]) Add(key []byte, item *V) error {
+	// Nil prefix not allowed.
+	if key == nil {
+		panic(ErrNilPrefix)
+	}
+
+	if len(b.stack) == 0 {
+		b.trie.Prefix = key[:0]
+		b.stack = append(b.stack, builderFrame[V]{node: b.trie})
+		b.appendPath(key, item)
+		return nil
+	}
+	if bytes.Compare(key, b.prev) <= 0 {
+		return fmt.Errorf("%w: %x added after %x", ErrUnsorted, key, b.prev)
+	}
+
+	// Close the nodes below the point where key leaves the path to the
+	// previous key. Since key is greater, it cannot end on that path.
+	common := commonPrefixLength(key, b.prev)
+	i := len(b.stack) - 1
+	for i > 0 && b.stack[i-1].end >= common {
+		i--
+	}
+	b.stack = b.stack[:i+1]
+
+	if top := &b.stack[i]; top.end > common {
+		// Split the node, moving its tail into a new child.
+		node := top.node
+		split := len(node.Prefix) - (top.end - common)
+		child := new(TrieOf[V])
+		*child = *node
+		*node = *node.newNode()
+		node.Prefix = child.Prefix[:split]
+		node.count = child.count
+		child.Prefix = child.Prefix[split:]
+		node.Children = node.Children.add(child.compact())
+		top.end = common
+	}
+	b.appendPath(key, item)
+	return nil
+}
+
+// Trie returns the built trie. The builder must not be used afterwards.
+func (b *BuilderOf[V]) Trie() *TrieOf[V] {
+	b.stack = nil
+	return b.trie
+}
+
+// appendPath stores item under key, creating the nodes missing below the last
+// open one.
+func (b *BuilderOf[V]) appendPath(key []byte, item *V) {
+	top := b.stack[len(b.stack)-1]
+	node, end := top.node, top.end
+	max := b.trie.maxPrefix()
+	if node == b.trie && len(node.Prefix) == 0 && node.Item == nil && node.Children.length() == 0 {
+		// The root of an empty trie takes the first chunk of the key.
+		n := len(key)
+		if n > max {
+			n = max
+		}
+		node.Prefix = key[:n]
+		end = n
+		b.stack[0].end = n
+	}
+
+	for end < len(key) {
+		n := len(key) - end
+		if n > max {
+			n = max
+		}
+		child := node.newNode()
+		child.Prefix = key[end : end+n]
+		node.Children = node.Children.add(child)
+		node, end = child, end+n
+		b.stack = append(b.stack, builderFrame[V]{node: node, end: end})
+	}
+	node.Item = item
+	if item != nil {
+		for i := range b.stack {
+			b.stack[i].node.count++
+		}
+	}
+	b.prev = key
+}
+
+func commonPrefixLength(a, b []byte) (i int) {
+	for ; i < len(a) && i < len(b) && a[i] == b[i]; i++ {
+	}
+	return
+}
+
+var ErrUnsorted = errors.New("keys added out of order")
@@ -0,0 +1,48 @@
+package indexer
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestBuilderMatchesInsert(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	for _, n := range []int{1, 2, 50, 2000} {
+		_, keys := randomTrie(rnd, n)
+		keys = append([][]byte{{}}, keys...)
+
+		inserted := NewTrie()
+		builder := NewBuilder()
+		for i, key := range keys {
+			item := &Item{Pos: uint64(i)}
+			inserted.Insert(key, item)
+			if err := builder.Add(key, item); err != nil {
+				t.Fatal(err)
+			}
+		}
+		built := builder.Trie()
+		if want, got := inserted.Dump(), built.Dump(); want != got {
+			t.Fatalf("%d keys: shapes differ\nwant:\n%s\ngot:\n%s", n, want, got)
+		}
+		assertSameItems(t, inserted, built)
+	}
+}
+
+func TestBuilderRejectsUnsortedKeys(t *testing.T) {
+	builder := NewBuilder()
+	if err := builder.Add([]byte("b"), &Item{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"b", "a", ""} {
+		if err := builder.Add([]byte(key), &Item{}); !errors.Is(err, ErrUnsorted) {
+			t.Fatalf("key %q: want %v, got %v", key, ErrUnsorted, err)
+		}
+	}
+	if err := builder.Add([]byte("ba"), &Item{}); err != nil {
+		t.Fatal(err)
+	}
+	if size := builder.Trie().Size(); size != 2 {
+		t.Fatalf("want 2 items, got %d", size)
+	}
+}
@@ -1,127 +1,232 @@
 package indexer
 
 import (
+	"bytes"
 	"fmt"
 	"io"
-	"sort"
 )
 
-type ChildList interface {
+type ChildListOf[V any] interface {
 	length() int
-	head() *Trie
-	add(child *Trie) ChildList
-	remove(b byte)
-	replace(b byte, child *Trie)
-	next(b byte) *Trie
-	walk(prefix *[]byte, visitor VisitorFunc) error
+	head() *TrieOf[V]
+	add(child *TrieOf[V]) ChildListOf[V]
+	remove(b byte) ChildListOf[V]
+	replace(b byte, child *TrieOf[V])
+	next(b byte) *TrieOf[V]
+	appendChildren(dst TriesOf[V]) TriesOf[V]
+	walk(prefix *[]byte, visitor VisitorFuncOf[V]) error
 	print(w io.Writer, indent int)
-	clone() ChildList
+	clone() ChildListOf[V]
+	shallowClone() ChildListOf[V]
 	total() int
+	countBefore(b byte) int
+	childAt(i int) (*TrieOf[V], int)
+	validate(max int) error
 }
 
-type Tries []*Trie
+// A node starts with a SparseChildList, which grows into an
+// IndexedChildList and finally into a DenseChildList as children are added,
+// and shrinks back as they are removed. This follows the Node4/16, Node48 and
+// Node256 of the adaptive radix tree, so both the many children of the root
+// of a hash-keyed trie and the few children of the nodes below it are stored
+// compactly.
+const (
+	minSparseCapacity   = 4
+	maxIndexedChildren  = 48
+	denseShrinkChildren = maxIndexedChildren / 2
+)
+
+type TriesOf[V any] []*TrieOf[V]
+
+// Item based instantiations of the child list types.
+type (
+	Tries            = TriesOf[Item]
+	SparseChildList  = SparseChildListOf[Item]
+	IndexedChildList = IndexedChildListOf[Item]
+	DenseChildList   = DenseChildListOf[Item]
+)
 
-func (t Tries) Len() int {
+func (t TriesOf[V]) Len() int {
 	return len(t)
 }
 
-func (t Tries) Less(i, j int) bool {
-	strings := sort.StringSlice{string(t[i].Prefix), string(t[j].Prefix)}
-	return strings.Less(0, 1)
+func (t TriesOf[V]) Less(i, j int) bool {
+	return bytes.Compare(t[i].Prefix, t[j].Prefix) < 0
 }
 
-func (t Tries) Swap(i, j int) {
+func (t TriesOf[V]) Swap(i, j int) {
 	t[i], t[j] = t[j], t[i]
 }
 
-type SparseChildList struct {
-	Children Tries
+// SparseChildListOf keeps up to max children in a slice sorted by the first
+// byte of their prefixes. Its capacity grows from minSparseCapacity up to max.
+// keys holds the first bytes next to each other, so that searching the list
+// does not touch the children.
+type SparseChildListOf[V any] struct {
+	Children TriesOf[V]
+
+	keys []byte
+	max  int
+}
+
+func newSparseChildList[V any](maxChildrenPerSparseNode int) ChildListOf[V] {
+	return &SparseChildListOf[V]{
+		max: maxChildrenPerSparseNode,
+	}
+}
+
+// newChildList returns the smallest child list holding children, which must
+// be sorted.
+func newChildList[V any](children TriesOf[V], maxChildrenPerSparseNode int) ChildListOf[V] {
+	switch n := len(children); {
+	case n <= maxChildrenPerSparseNode:
+		list := &SparseChildListOf[V]{max: maxChildrenPerSparseNode}
+		if n != 0 {
+			c := sparseCapacity(n, maxChildrenPerSparseNode)
+			list.Children = make(TriesOf[V], n, c)
+			list.keys = make([]byte, n, c)
+			for i, child := range children {
+				list.Children[i] = child
+				list.keys[i] = child.Prefix[0]
+			}
+		}
+		return list
+
+	case n <= maxIndexedChildren:
+		list := &IndexedChildListOf[V]{max: maxChildrenPerSparseNode}
+		for _, child := range children {
+			list.put(child)
+		}
+		return list
+
+	default:
+		list := &DenseChildListOf[V]{max: maxChildrenPerSparseNode}
+		for _, child := range children {
+			list.Children[child.Prefix[0]] = child
+		}
+		list.NumChildren = n
+		return list
+	}
 }
 
-func newSparseChildList(maxChildrenPerSparseNode int) ChildList {
-	return &SparseChildList{
-		Children: make(Tries, 0, maxChildrenPerSparseNode),
+// sparseCapacity returns the capacity of a sparse list holding n children,
+// quadrupling from minSparseCapacity.
+func sparseCapacity(n, max int) int {
+	c := minSparseCapacity
+	for c < n {
+		c *= 4
 	}
+	if c > max {
+		c = max
+	}
+	return c
 }
 
-func (list *SparseChildList) length() int {
+func (list *SparseChildListOf[V]) length() int {
 	return len(list.Children)
 }
 
-func (list *SparseChildList) head() *Trie {
+func (list *SparseChildListOf[V]) head() *TrieOf[V] {
 	return list.Children[0]
 }
 
-func (list *SparseChildList) add(child *Trie) ChildList {
-	// Search for an empty spot and insert the child if possible.
-	if len(list.Children) != cap(list.Children) {
-		list.Children = append(list.Children, child)
-		return list
+// search returns the position of the first child whose prefix starts with a
+// byte not smaller than b.
+func (list *SparseChildListOf[V]) search(b byte) int {
+	lo, hi := 0, len(list.keys)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if list.keys[mid] < b {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
 	}
+	return lo
+}
 
-	// Otherwise we have to transform to the dense list type.
-	return newDenseChildList(list, child)
+func (list *SparseChildListOf[V]) add(child *TrieOf[V]) ChildListOf[V] {
+	n := len(list.Children)
+	i := list.search(child.Prefix[0])
+	if n == list.max {
+		// Transform to a bigger list type.
+		children := make(TriesOf[V], 0, n+1)
+		children = append(children, list.Children[:i]...)
+		children = append(children, child)
+		children = append(children, list.Children[i:]...)
+		return newChildList(children, list.max)
+	}
+
+	children, keys := list.Children, list.keys
+	if n == cap(children) {
+		// Grow the slices.
+		c := sparseCapacity(n+1, list.max)
+		children = make(TriesOf[V], n, c)
+		copy(children, list.Children)
+		keys = make([]byte, n, c)
+		copy(keys, list.keys)
+	}
+
+	// Insert the child at its position.
+	children, keys = children[:n+1], keys[:n+1]
+	copy(children[i+1:], children[i:n])
+	copy(keys[i+1:], keys[i:n])
+	children[i], keys[i] = child, child.Prefix[0]
+	list.Children, list.keys = children, keys
+	return list
 }
 
-func (list *SparseChildList) remove(b byte) {
-	for i, node := range list.Children {
-		if node.Prefix[0] == b {
-			list.Children[i] = list.Children[len(list.Children)-1]
-			list.Children[len(list.Children)-1] = nil
-			list.Children = list.Children[:len(list.Children)-1]
-			return
-		}
+func (list *SparseChildListOf[V]) remove(b byte) ChildListOf[V] {
+	i := list.search(b)
+	if i == len(list.keys) || list.keys[i] != b {
+		// This is not supposed to be reached.
+		panic("removing non-existent child")
 	}
 
-	// This is not supposed to be reached.
-	panic("removing non-existent child")
+	n := len(list.Children) - 1
+	copy(list.Children[i:], list.Children[i+1:])
+	copy(list.keys[i:], list.keys[i+1:])
+	list.Children[n] = nil
+	list.Children, list.keys = list.Children[:n], list.keys[:n]
+
+	// Release the slices once they are mostly empty.
+	if n <= minSparseCapacity/2 && cap(list.Children) > minSparseCapacity {
+		children := make(TriesOf[V], n, minSparseCapacity)
+		copy(children, list.Children)
+		keys := make([]byte, n, minSparseCapacity)
+		copy(keys, list.keys)
+		list.Children, list.keys = children, keys
+	}
+	return list
 }
 
-func (list *SparseChildList) replace(b byte, child *Trie) {
+func (list *SparseChildListOf[V]) replace(b byte, child *TrieOf[V]) {
 	// Make a consistency check.
 	if p0 := child.Prefix[0]; p0 != b {
 		panic(fmt.Errorf("child prefix mismatch: %v != %v", p0, b))
 	}
 
 	// Seek the child and replace it.
-	for i, node := range list.Children {
-		if node.Prefix[0] == b {
-			list.Children[i] = child
-			return
-		}
+	if i := list.search(b); i != len(list.keys) && list.keys[i] == b {
+		list.Children[i] = child
 	}
 }
 
-func (list *SparseChildList) next(b byte) *Trie {
-	for _, child := range list.Children {
-		if child.Prefix[0] == b {
-			return child
-		}
+func (list *SparseChildListOf[V]) next(b byte) *TrieOf[V] {
+	if i := list.search(b); i != len(list.keys) && list.keys[i] == b {
+		return list.Children[i]
 	}
 	return nil
 }
 
-func (list *SparseChildList) walk(prefix *[]byte, visitor VisitorFunc) error {
-
-	sort.Sort(list.Children)
+// appendChildren appends the children to dst in ascending order.
+func (list *SparseChildListOf[V]) appendChildren(dst TriesOf[V]) TriesOf[V] {
+	return append(dst, list.Children...)
+}
 
+func (list *SparseChildListOf[V]) walk(prefix *[]byte, visitor VisitorFuncOf[V]) error {
 	for _, child := range list.Children {
-		*prefix = append(*prefix, child.Prefix...)
-		if child.Item != nil {
-			err := visitor(*prefix, child.Item)
-			if err != nil {
-				if err == ErrSkipSubtree {
-					*prefix = (*prefix)[:len(*prefix)-len(child.Prefix)]
-					continue
-				}
-				*prefix = (*prefix)[:len(*prefix)-len(child.Prefix)]
-				return err
-			}
-		}
-
-		err := child.Children.walk(prefix, visitor)
-		*prefix = (*prefix)[:len(*prefix)-len(child.Prefix)]
-		if err != nil {
+		if err := child.walkChild(prefix, visitor); err != nil {
 			return err
 		}
 	}
@@ -129,7 +234,7 @@ func (list *SparseChildList) walk(prefix *[]byte, visitor VisitorFunc) error {
 	return nil
 }
 
-func (list *SparseChildList) total() int {
+func (list *SparseChildListOf[V]) total() int {
 	tot := 0
 	for _, child := range list.Children {
 		if child != nil {
@@ -139,18 +244,53 @@ func (list *SparseChildList) total() int {
 	return tot
 }
 
-func (list *SparseChildList) clone() ChildList {
-	clones := make(Tries, len(list.Children), cap(list.Children))
+// countBefore returns the number of items under the children whose prefix
+// starts with a byte smaller than b.
+func (list *SparseChildListOf[V]) countBefore(b byte) int {
+	n := 0
+	for _, child := range list.Children[:list.search(b)] {
+		n += child.count
+	}
+	return n
+}
+
+// childAt returns the child holding the i-th item under the children in key
+// order, and the position of that item within the child. i must be smaller
+// than the number of items.
+func (list *SparseChildListOf[V]) childAt(i int) (*TrieOf[V], int) {
+	for _, child := range list.Children {
+		if i < child.count {
+			return child, i
+		}
+		i -= child.count
+	}
+	return nil, i
+}
+
+func (list *SparseChildListOf[V]) clone() ChildListOf[V] {
+	clones := make(TriesOf[V], len(list.Children), cap(list.Children))
 	for i, child := range list.Children {
 		clones[i] = child.Clone()
 	}
 
-	return &SparseChildList{
+	return &SparseChildListOf[V]{
 		Children: clones,
+		keys:     append(make([]byte, 0, cap(list.keys)), list.keys...),
+		max:      list.max,
+	}
+}
+
+func (list *SparseChildListOf[V]) shallowClone() ChildListOf[V] {
+	children := make(TriesOf[V], len(list.Children), cap(list.Children))
+	copy(children, list.Children)
+	return &SparseChildListOf[V]{
+		Children: children,
+		keys:     append(make([]byte, 0, cap(list.keys)), list.keys...),
+		max:      list.max,
 	}
 }
 
-func (list *SparseChildList) print(w io.Writer, indent int) {
+func (list *SparseChildListOf[V]) print(w io.Writer, indent int) {
 	for _, child := range list.Children {
 		if child != nil {
 			child.print(w, indent)
@@ -158,154 +298,243 @@ func (list *SparseChildList) print(w io.Writer, indent int) {
 	}
 }
 
-type DenseChildList struct {
-	Min         int
-	Max         int
+// IndexedChildListOf keeps up to maxIndexedChildren children. Index maps the
+// first byte of a child prefix to its position in Children plus one, zero
+// standing for no child.
+type IndexedChildListOf[V any] struct {
 	NumChildren int
-	HeadIndex   int
-	Children    []*Trie
+	Index       [256]uint8
+	Children    [maxIndexedChildren]*TrieOf[V]
+
+	max int
 }
 
-func newDenseChildList(list *SparseChildList, child *Trie) ChildList {
-	var (
-		min int = 255
-		max int = 0
-	)
-	for _, child := range list.Children {
-		b := int(child.Prefix[0])
-		if b < min {
-			min = b
-		}
-		if b > max {
-			max = b
+func (list *IndexedChildListOf[V]) length() int {
+	return list.NumChildren
+}
+
+func (list *IndexedChildListOf[V]) head() *TrieOf[V] {
+	for _, i := range list.Index {
+		if i != 0 {
+			return list.Children[i-1]
 		}
 	}
+	return nil
+}
+
+// put stores a child into the first free slot.
+func (list *IndexedChildListOf[V]) put(child *TrieOf[V]) {
+	list.Children[list.NumChildren] = child
+	list.NumChildren++
+	list.Index[child.Prefix[0]] = uint8(list.NumChildren)
+}
 
-	b := int(child.Prefix[0])
-	if b < min {
-		min = b
+func (list *IndexedChildListOf[V]) add(child *TrieOf[V]) ChildListOf[V] {
+	if list.Index[child.Prefix[0]] != 0 {
+		panic("indexed child list collision detected")
 	}
-	if b > max {
-		max = b
+	if list.NumChildren < maxIndexedChildren {
+		list.put(child)
+		return list
 	}
 
-	children := make([]*Trie, max-min+1)
-	for _, child := range list.Children {
-		children[int(child.Prefix[0])-min] = child
+	// Otherwise we have to transform to the dense list type.
+	children := list.appendChildren(make(TriesOf[V], 0, list.NumChildren+1))
+	return newChildList(append(children, child), list.max)
+}
+
+func (list *IndexedChildListOf[V]) remove(b byte) ChildListOf[V] {
+	i := int(list.Index[b]) - 1
+	if i < 0 {
+		// This is not supposed to be reached.
+		panic("removing non-existent child")
 	}
-	children[int(child.Prefix[0])-min] = child
 
-	return &DenseChildList{
-		Min:         min,
-		Max:         max,
-		NumChildren: list.length() + 1,
-		HeadIndex:   0,
-		Children:    children,
+	// Move the last child into the freed slot.
+	last := list.NumChildren - 1
+	if i != last {
+		moved := list.Children[last]
+		list.Children[i] = moved
+		list.Index[moved.Prefix[0]] = uint8(i + 1)
 	}
+	list.Children[last] = nil
+	list.Index[b] = 0
+	list.NumChildren--
+
+	if list.NumChildren <= list.max/2 {
+		return newChildList(list.appendChildren(nil), list.max)
+	}
+	return list
 }
 
-func (list *DenseChildList) length() int {
-	return list.NumChildren
+func (list *IndexedChildListOf[V]) replace(b byte, child *TrieOf[V]) {
+	// Make a consistency check.
+	if p0 := child.Prefix[0]; p0 != b {
+		panic(fmt.Errorf("child prefix mismatch: %v != %v", p0, b))
+	}
+
+	// Replace the child.
+	if i := list.Index[b]; i != 0 {
+		list.Children[i-1] = child
+	}
 }
 
-func (list *DenseChildList) head() *Trie {
-	return list.Children[list.HeadIndex]
+func (list *IndexedChildListOf[V]) next(b byte) *TrieOf[V] {
+	if i := list.Index[b]; i != 0 {
+		return list.Children[i-1]
+	}
+	return nil
 }
 
-func (list *DenseChildList) add(child *Trie) ChildList {
-	b := int(child.Prefix[0])
-	var i int
+func (list *IndexedChildListOf[V]) appendChildren(dst TriesOf[V]) TriesOf[V] {
+	for _, i := range list.Index {
+		if i != 0 {
+			dst = append(dst, list.Children[i-1])
+		}
+	}
+	return dst
+}
 
-	switch {
-	case list.Min <= b && b <= list.Max:
-		if list.Children[b-list.Min] != nil {
-			panic("dense child list collision detected")
+func (list *IndexedChildListOf[V]) walk(prefix *[]byte, visitor VisitorFuncOf[V]) error {
+	for _, i := range list.Index {
+		if i == 0 {
+			continue
 		}
-		i = b - list.Min
-		list.Children[i] = child
+		if err := list.Children[i-1].walkChild(prefix, visitor); err != nil {
+			return err
+		}
+	}
 
-	case b < list.Min:
-		children := make([]*Trie, list.Max-b+1)
-		i = 0
-		children[i] = child
-		copy(children[list.Min-b:], list.Children)
-		list.Children = children
-		list.Min = b
-
-	default: // b > list.max
-		children := make([]*Trie, b-list.Min+1)
-		i = b - list.Min
-		children[i] = child
-		copy(children, list.Children)
-		list.Children = children
-		list.Max = b
+	return nil
+}
+
+func (list *IndexedChildListOf[V]) print(w io.Writer, indent int) {
+	for _, i := range list.Index {
+		if i != 0 {
+			list.Children[i-1].print(w, indent)
+		}
 	}
+}
 
-	list.NumChildren++
-	if i < list.HeadIndex {
-		list.HeadIndex = i
+func (list *IndexedChildListOf[V]) countBefore(b byte) int {
+	n := 0
+	for _, i := range list.Index[:b] {
+		if i != 0 {
+			n += list.Children[i-1].count
+		}
+	}
+	return n
+}
+
+func (list *IndexedChildListOf[V]) childAt(i int) (*TrieOf[V], int) {
+	for _, j := range list.Index {
+		if j == 0 {
+			continue
+		}
+		child := list.Children[j-1]
+		if i < child.count {
+			return child, i
+		}
+		i -= child.count
+	}
+	return nil, i
+}
+
+func (list *IndexedChildListOf[V]) clone() ChildListOf[V] {
+	clone := *list
+	for i := 0; i < list.NumChildren; i++ {
+		clone.Children[i] = list.Children[i].Clone()
+	}
+	return &clone
+}
+
+func (list *IndexedChildListOf[V]) shallowClone() ChildListOf[V] {
+	clone := *list
+	return &clone
+}
+
+func (list *IndexedChildListOf[V]) total() int {
+	tot := 0
+	for i := 0; i < list.NumChildren; i++ {
+		tot = tot + list.Children[i].total()
+	}
+	return tot
+}
+
+// DenseChildListOf keeps a slot for every possible first byte.
+type DenseChildListOf[V any] struct {
+	NumChildren int
+	Children    [256]*TrieOf[V]
+
+	max int
+}
+
+func (list *DenseChildListOf[V]) length() int {
+	return list.NumChildren
+}
+
+func (list *DenseChildListOf[V]) head() *TrieOf[V] {
+	for _, child := range list.Children {
+		if child != nil {
+			return child
+		}
+	}
+	return nil
+}
+
+func (list *DenseChildListOf[V]) add(child *TrieOf[V]) ChildListOf[V] {
+	b := child.Prefix[0]
+	if list.Children[b] != nil {
+		panic("dense child list collision detected")
 	}
+	list.Children[b] = child
+	list.NumChildren++
 	return list
 }
 
-func (list *DenseChildList) remove(b byte) {
-	i := int(b) - list.Min
-	if list.Children[i] == nil {
+func (list *DenseChildListOf[V]) remove(b byte) ChildListOf[V] {
+	if list.Children[b] == nil {
 		// This is not supposed to be reached.
 		panic("removing non-existent child")
 	}
 	list.NumChildren--
-	list.Children[i] = nil
-
-	// Update head index.
-	if i == list.HeadIndex {
-		for ; i < len(list.Children); i++ {
-			if list.Children[i] != nil {
-				list.HeadIndex = i
-				return
-			}
-		}
+	list.Children[b] = nil
+
+	if list.NumChildren <= denseShrinkChildren {
+		return newChildList(list.appendChildren(nil), list.max)
 	}
+	return list
 }
 
-func (list *DenseChildList) replace(b byte, child *Trie) {
+func (list *DenseChildListOf[V]) replace(b byte, child *TrieOf[V]) {
 	// Make a consistency check.
 	if p0 := child.Prefix[0]; p0 != b {
 		panic(fmt.Errorf("child prefix mismatch: %v != %v", p0, b))
 	}
 
 	// Replace the child.
-	list.Children[int(b)-list.Min] = child
+	list.Children[b] = child
 }
 
-func (list *DenseChildList) next(b byte) *Trie {
-	i := int(b)
-	if i < list.Min || list.Max < i {
-		return nil
+func (list *DenseChildListOf[V]) next(b byte) *TrieOf[V] {
+	return list.Children[b]
+}
+
+func (list *DenseChildListOf[V]) appendChildren(dst TriesOf[V]) TriesOf[V] {
+	for _, child := range list.Children {
+		if child != nil {
+			dst = append(dst, child)
+		}
 	}
-	return list.Children[i-list.Min]
+	return dst
 }
 
-func (list *DenseChildList) walk(prefix *[]byte, visitor VisitorFunc) error {
+func (list *DenseChildListOf[V]) walk(prefix *[]byte, visitor VisitorFuncOf[V]) error {
 	for _, child := range list.Children {
 		if child == nil {
 			continue
 		}
-		*prefix = append(*prefix, child.Prefix...)
-		if child.Item != nil {
-			if err := visitor(*prefix, child.Item); err != nil {
-				if err == ErrSkipSubtree {
-					*prefix = (*prefix)[:len(*prefix)-len(child.Prefix)]
-					continue
-				}
-				*prefix = (*prefix)[:len(*prefix)-len(child.Prefix)]
-				return err
-			}
-		}
-
-		err := child.Children.walk(prefix, visitor)
-		*prefix = (*prefix)[:len(*prefix)-len(child.Prefix)]
-		if err != nil {
+		if err := child.walkChild(prefix, visitor); err != nil {
 			return err
 		}
 	}
@@ -313,7 +542,7 @@ func (list *DenseChildList) walk(prefix *[]byte, visitor VisitorFunc) error {
 	return nil
 }
 
-func (list *DenseChildList) print(w io.Writer, indent int) {
+func (list *DenseChildListOf[V]) print(w io.Writer, indent int) {
 	for _, child := range list.Children {
 		if child != nil {
 			child.print(w, indent)
@@ -321,33 +550,45 @@ func (list *DenseChildList) print(w io.Writer, indent int) {
 	}
 }
 
-func (list *DenseChildList) clone() ChildList {
-	clones := make(Tries, cap(list.Children))
+func (list *DenseChildListOf[V]) countBefore(b byte) int {
+	n := 0
+	for _, child := range list.Children[:b] {
+		if child != nil {
+			n += child.count
+		}
+	}
+	return n
+}
 
-	if list.NumChildren != 0 {
-		clonedCount := 0
-		for i := list.HeadIndex; i < len(list.Children); i++ {
-			child := list.Children[i]
-			if child != nil {
-				clones[i] = child.Clone()
-				clonedCount++
-				if clonedCount == list.NumChildren {
-					break
-				}
-			}
+func (list *DenseChildListOf[V]) childAt(i int) (*TrieOf[V], int) {
+	for _, child := range list.Children {
+		if child == nil {
+			continue
+		}
+		if i < child.count {
+			return child, i
 		}
+		i -= child.count
 	}
+	return nil, i
+}
 
-	return &DenseChildList{
-		Min:         list.Min,
-		Max:         list.Max,
-		NumChildren: list.NumChildren,
-		HeadIndex:   list.HeadIndex,
-		Children:    clones,
+func (list *DenseChildListOf[V]) clone() ChildListOf[V] {
+	clone := *list
+	for i, child := range list.Children {
+		if child != nil {
+			clone.Children[i] = child.Clone()
+		}
 	}
+	return &clone
+}
+
+func (list *DenseChildListOf[V]) shallowClone() ChildListOf[V] {
+	clone := *list
+	return &clone
 }
 
-func (list *DenseChildList) total() int {
+func (list *DenseChildListOf[V]) total() int {
 	tot := 0
 	for _, child := range list.Children {
 		if child != nil {
@@ -356,3 +597,19 @@ func (list *DenseChildList) total() int {
 	}
 	return tot
 }
+
+// walkChild visits the items of a child, prefix being the key of its parent.
+func (child *TrieOf[V]) walkChild(prefix *[]byte, visitor VisitorFuncOf[V]) error {
+	*prefix = append(*prefix, child.Prefix...)
+	var err error
+	if child.Item != nil {
+		err = visitor(*prefix, child.Item)
+	}
+	if err == nil {
+		err = child.Children.walk(prefix, visitor)
+	} else if err == ErrSkipSubtree {
+		err = nil
+	}
+	*prefix = (*prefix)[:len(*prefix)-len(child.Prefix)]
+	return err
+}
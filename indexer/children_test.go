@@ -0,0 +1,136 @@
+package indexer
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func childKind(list ChildList) string {
+	return fmt.Sprintf("%T", list)
+}
+
+func TestChildListTransitions(t *testing.T) {
+	rnd := rand.New(rand.NewSource(15))
+	order := rnd.Perm(256)
+
+	var list ChildList = newSparseChildList[Item](defaultMaxChildrenPerSparseNode)
+	kinds := map[int]string{
+		0:   childKind(&SparseChildList{}),
+		16:  childKind(&SparseChildList{}),
+		17:  childKind(&IndexedChildList{}),
+		48:  childKind(&IndexedChildList{}),
+		49:  childKind(&DenseChildList{}),
+		256: childKind(&DenseChildList{}),
+	}
+	assertList := func(present map[byte]bool) {
+		t.Helper()
+		if kind, ok := kinds[len(present)]; ok && childKind(list) != kind {
+			t.Fatalf("%d children: want %s, got %s", len(present), kind, childKind(list))
+		}
+		if list.length() != len(present) {
+			t.Fatalf("want %d children, got %d", len(present), list.length())
+		}
+		var prev *Trie
+		for _, child := range list.appendChildren(nil) {
+			if prev != nil && prev.Prefix[0] >= child.Prefix[0] {
+				t.Fatalf("children out of order: %d >= %d", prev.Prefix[0], child.Prefix[0])
+			}
+			prev = child
+		}
+		before := 0
+		for b := 0; b < 256; b++ {
+			if got := list.countBefore(byte(b)); got != before {
+				t.Fatalf("count before %d: want %d, got %d", b, before, got)
+			}
+			child := list.next(byte(b))
+			if (child != nil) != present[byte(b)] {
+				t.Fatalf("byte %d: present %v, got %v", b, present[byte(b)], child)
+			}
+			if child != nil {
+				before += child.count
+			}
+		}
+	}
+
+	present := make(map[byte]bool)
+	for _, b := range order {
+		list = list.add(&Trie{Prefix: []byte{byte(b), 1}, count: 1})
+		present[byte(b)] = true
+		assertList(present)
+	}
+
+	shrunk := map[int]string{
+		24: childKind(&IndexedChildList{}),
+		8:  childKind(&SparseChildList{}),
+		0:  childKind(&SparseChildList{}),
+	}
+	kinds = shrunk
+	for _, b := range order {
+		list = list.remove(byte(b))
+		delete(present, byte(b))
+		assertList(present)
+	}
+}
+
+func TestHighFanoutTrie(t *testing.T) {
+	trie := newHashTrie(5000)
+	if kind := childKind(trie.Children); kind != childKind(&DenseChildList{}) {
+		t.Fatalf("root of a hash trie uses %s", kind)
+	}
+
+	keys := sortedKeys(trie)
+	for _, key := range keys[:4990] {
+		if !trie.Delete(key) {
+			t.Fatalf("key %x not deleted", key)
+		}
+	}
+	if kind := childKind(trie.Children); kind != childKind(&SparseChildList{}) {
+		t.Fatalf("root did not shrink, uses %s", kind)
+	}
+	for _, key := range keys[4990:] {
+		if trie.Get(key) == nil {
+			t.Fatalf("key %x lost", key)
+		}
+	}
+}
+
+// newDecimalTrie returns a trie keyed by decimal numbers, whose nodes have at
+// most ten children and therefore all use sparse child lists.
+func newDecimalTrie(n int) (*Trie, [][]byte) {
+	trie := NewTrie()
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprint(i * 7919 % n))
+		trie.Insert(keys[i], &Item{Pos: uint64(i)})
+	}
+	return trie, keys
+}
+
+func BenchmarkWalk(b *testing.B) {
+	trie, _ := newDecimalTrie(100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trie.Walk(nil, func(_ []byte, _ *Item) error {
+			return nil
+		})
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	trie, _ := newDecimalTrie(100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := trie.Marshal(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	trie, keys := newDecimalTrie(100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trie.Get(keys[i%len(keys)])
+	}
+}
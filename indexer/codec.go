@@ -0,0 +1,49 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ValueCodec serializes the values stored in a TrieOf. It is used by Marshal,
+// WriteTo, WriteIndex and their reading counterparts.
+type ValueCodec[V any] interface {
+	// Size returns the length of every encoded value, or zero when the
+	// length varies between values.
+	Size() int
+	// AppendValue appends the encoding of value to dst.
+	AppendValue(dst []byte, value *V) []byte
+	// DecodeValue decodes the bytes produced by AppendValue. The data is
+	// reused afterwards and must not be retained.
+	DecodeValue(data []byte) (*V, error)
+}
+
+// ItemCodec encodes an Item as its 8-byte big-endian Pos and Length, which is
+// the record layout used since the first version of the file format.
+type ItemCodec struct{}
+
+func (ItemCodec) Size() int {
+	return itemSize
+}
+
+func (ItemCodec) AppendValue(dst []byte, item *Item) []byte {
+	dst = append(dst, Itos(item.Pos)...)
+	return append(dst, Itos(item.Length)...)
+}
+
+func (ItemCodec) DecodeValue(data []byte) (*Item, error) {
+	if len(data) != itemSize {
+		return nil, fmt.Errorf("%w: item of %d bytes", ErrCorrupted, len(data))
+	}
+	return &Item{Pos: Stoi(data[:8]), Length: Stoi(data[8:])}, nil
+}
+
+// codec returns the value codec of the trie, or ErrNoCodec.
+func (trie *TrieOf[V]) codec() (ValueCodec[V], error) {
+	if trie.cfg == nil || trie.cfg.codec == nil {
+		return nil, ErrNoCodec
+	}
+	return trie.cfg.codec, nil
+}
+
+var ErrNoCodec = errors.New("trie has no value codec")
@@ -0,0 +1,107 @@
+package indexer
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stringCodec stores strings as they are, so values vary in size.
+type stringCodec struct{}
+
+func (stringCodec) Size() int {
+	return 0
+}
+
+func (stringCodec) AppendValue(dst []byte, value *string) []byte {
+	return append(dst, *value...)
+}
+
+func (stringCodec) DecodeValue(data []byte) (*string, error) {
+	value := string(data)
+	return &value, nil
+}
+
+// flagCodec stores a single byte per value.
+type flagCodec struct{}
+
+func (flagCodec) Size() int {
+	return 1
+}
+
+func (flagCodec) AppendValue(dst []byte, value *byte) []byte {
+	return append(dst, *value)
+}
+
+func (flagCodec) DecodeValue(data []byte) (*byte, error) {
+	value := data[0]
+	return &value, nil
+}
+
+func TestGenericValueRoundTrip(t *testing.T) {
+	trie := NewTrieOf[string](stringCodec{})
+	values := map[string]string{
+		"block/1":  "",
+		"block/2":  "genesis",
+		"block/20": strings.Repeat("x", 300),
+		"account":  "frozen",
+	}
+	for key, value := range values {
+		value := value
+		trie.Insert([]byte(key), &value)
+	}
+
+	data, err := trie.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewTrieOf[string](stringCodec{})
+	if err := loaded.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Size() != len(values) {
+		t.Fatalf("want %d items, got %d", len(values), loaded.Size())
+	}
+	for key, value := range values {
+		if got := loaded.Get([]byte(key)); got == nil || *got != value {
+			t.Fatalf("key %q: want %q, got %v", key, value, got)
+		}
+	}
+
+	if _, err := trie.WriteIndex(&strings.Builder{}); !errors.Is(err, ErrValueSize) {
+		t.Fatalf("want %v, got %v", ErrValueSize, err)
+	}
+}
+
+func TestGenericIndex(t *testing.T) {
+	trie := NewTrieOf[byte](flagCodec{})
+	for i := 0; i < 256; i++ {
+		flag := byte(i)
+		trie.Insert([]byte{flag, 0xff - flag}, &flag)
+	}
+	filename := filepath.Join(t.TempDir(), "flags")
+	if err := trie.SaveIndexToFile(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := OpenIndexOf[byte](filename, flagCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	for i := 0; i < 256; i++ {
+		if got := idx.Get([]byte{byte(i), 0xff - byte(i)}); got == nil || *got != byte(i) {
+			t.Fatalf("flag %d: got %v", i, got)
+		}
+	}
+}
+
+func TestMarshalWithoutCodec(t *testing.T) {
+	trie := NewTrieOf[int](nil)
+	value := 1
+	trie.Insert([]byte("key"), &value)
+	if _, err := trie.Marshal(); !errors.Is(err, ErrNoCodec) {
+		t.Fatalf("want %v, got %v", ErrNoCodec, err)
+	}
+}
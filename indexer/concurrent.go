@@ -0,0 +1,247 @@
+package indexer
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"sync"
+)
+
+// ConcurrentTrieOf wraps a TrieOf with readers/writer locking so that it can be
+// shared between goroutines. Lookups and walks share a read lock, mutations
+// take the write lock.
+//
+// Visitors run while the read lock is held, so they must not call methods
+// that modify the same ConcurrentTrieOf.
+type ConcurrentTrieOf[V any] struct {
+	mu   sync.RWMutex
+	trie *TrieOf[V]
+}
+
+// ConcurrentTrie is the Item based instantiation of ConcurrentTrieOf.
+type ConcurrentTrie = ConcurrentTrieOf[Item]
+
+// NewConcurrentTrie returns an empty ConcurrentTrie.
+func NewConcurrentTrie() *ConcurrentTrie {
+	return &ConcurrentTrie{trie: NewTrie()}
+}
+
+// NewConcurrentTrieFrom wraps an existing trie. The trie must not be used
+// directly afterwards.
+func NewConcurrentTrieFrom[V any](trie *TrieOf[V]) *ConcurrentTrieOf[V] {
+	return &ConcurrentTrieOf[V]{trie: trie}
+}
+
+func (ct *ConcurrentTrieOf[V]) Insert(key []byte, item *V) (inserted bool) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	return ct.trie.Insert(key, item)
+}
+
+func (ct *ConcurrentTrieOf[V]) Set(key []byte, item *V) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.trie.Set(key, item)
+}
+
+func (ct *ConcurrentTrieOf[V]) Delete(key []byte) (deleted bool) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	return ct.trie.Delete(key)
+}
+
+func (ct *ConcurrentTrieOf[V]) DeleteSubtree(prefix []byte) (deleted bool) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	return ct.trie.DeleteSubtree(prefix)
+}
+
+// Merge moves the items of other into the trie, see TrieOf.Merge. resolve
+// runs while the write lock is held.
+func (ct *ConcurrentTrieOf[V]) Merge(other *TrieOf[V], resolve ResolveFuncOf[V]) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.trie.Merge(other, resolve)
+}
+
+func (ct *ConcurrentTrieOf[V]) Get(key []byte) *V {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.Get(key)
+}
+
+func (ct *ConcurrentTrieOf[V]) Match(prefix []byte) (matchedExactly bool) {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.Match(prefix)
+}
+
+func (ct *ConcurrentTrieOf[V]) MatchSubtree(key []byte) (matched bool) {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.MatchSubtree(key)
+}
+
+func (ct *ConcurrentTrieOf[V]) Visit(visitor VisitorFuncOf[V]) error {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.Visit(visitor)
+}
+
+func (ct *ConcurrentTrieOf[V]) VisitSubtree(prefix []byte, visitor VisitorFuncOf[V]) error {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.VisitSubtree(prefix, visitor)
+}
+
+func (ct *ConcurrentTrieOf[V]) VisitPrefixes(key []byte, visitor VisitorFuncOf[V]) error {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.VisitPrefixes(key, visitor)
+}
+
+func (ct *ConcurrentTrieOf[V]) WalkRange(start, end Bound, visitor VisitorFuncOf[V]) error {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.WalkRange(start, end, visitor)
+}
+
+func (ct *ConcurrentTrieOf[V]) WalkReverse(start, end Bound, visitor VisitorFuncOf[V]) error {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.WalkReverse(start, end, visitor)
+}
+
+func (ct *ConcurrentTrieOf[V]) WalkContext(ctx context.Context, visitor VisitorFuncOf[V]) error {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.WalkContext(ctx, visitor)
+}
+
+func (ct *ConcurrentTrieOf[V]) WalkPage(ctx context.Context, opts WalkOptions, visitor VisitorFuncOf[V]) ([]byte, error) {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.WalkPage(ctx, opts, visitor)
+}
+
+func (ct *ConcurrentTrieOf[V]) Size() int {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.Size()
+}
+
+func (ct *ConcurrentTrieOf[V]) CountPrefix(prefix []byte) int {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.CountPrefix(prefix)
+}
+
+func (ct *ConcurrentTrieOf[V]) Rank(key []byte) int {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.Rank(key)
+}
+
+func (ct *ConcurrentTrieOf[V]) Select(i int) (key []byte, item *V) {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.Select(i)
+}
+
+func (ct *ConcurrentTrieOf[V]) Floor(key []byte) ([]byte, *V) {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.Floor(key)
+}
+
+func (ct *ConcurrentTrieOf[V]) Ceil(key []byte) ([]byte, *V) {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.Ceil(key)
+}
+
+func (ct *ConcurrentTrieOf[V]) LongestPrefix(key []byte) ([]byte, *V) {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.LongestPrefix(key)
+}
+
+func (ct *ConcurrentTrieOf[V]) Empty() bool {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.Empty()
+}
+
+// Root returns the Merkle root of the current contents. Hashes are cached
+// atomically, so Root only takes the read lock.
+func (ct *ConcurrentTrieOf[V]) Root() ([]byte, error) {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.Root()
+}
+
+func (ct *ConcurrentTrieOf[V]) Prove(key []byte) (*Proof, error) {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.Prove(key)
+}
+
+// Clone returns an unsynchronized copy of the current contents.
+func (ct *ConcurrentTrieOf[V]) Clone() *TrieOf[V] {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.Clone()
+}
+
+func (ct *ConcurrentTrieOf[V]) Marshal() ([]byte, error) {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.Marshal()
+}
+
+func (ct *ConcurrentTrieOf[V]) WriteTo(w io.Writer) (int64, error) {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.WriteTo(w)
+}
+
+func (ct *ConcurrentTrieOf[V]) SaveToFile(filename string, opts ...SaveOption) error {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.SaveToFile(filename, opts...)
+}
+
+// ReadFrom decodes the input before taking the write lock, so readers are
+// only blocked while the loaded items are being added. Like TrieOf.ReadFrom,
+// an empty trie takes over the options stored in the input.
+func (ct *ConcurrentTrieOf[V]) ReadFrom(r io.Reader) (int64, error) {
+	base, empty := ct.newNode()
+	loaded, n, err := base.load(r, empty)
+	if err != nil {
+		return n, err
+	}
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.trie.add(loaded)
+	return n, nil
+}
+
+func (ct *ConcurrentTrieOf[V]) ReadFromFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = ct.ReadFrom(bufio.NewReader(f))
+	return err
+}
+
+// newNode returns an empty trie with the settings of the wrapped one, and
+// whether the wrapped one is empty.
+func (ct *ConcurrentTrieOf[V]) newNode() (*TrieOf[V], bool) {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.trie.newNode(), ct.trie.Empty()
+}
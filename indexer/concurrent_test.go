@@ -0,0 +1,130 @@
+package indexer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func hashKey(i int) []byte {
+	key := sha256.Sum256([]byte(strconv.Itoa(i)))
+	return key[:]
+}
+
+func TestConcurrentTrieInterleaving(t *testing.T) {
+	const (
+		writers = 4
+		readers = 4
+		perG    = 500
+	)
+	ct := NewConcurrentTrie()
+	for i := 0; i < perG; i++ {
+		ct.Insert(hashKey(-i-1), &Item{Pos: uint64(i)})
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perG; i++ {
+				key := hashKey(w*perG + i)
+				ct.Insert(key, &Item{Pos: uint64(i)})
+				ct.Set(key, &Item{Pos: uint64(i), Length: 1})
+				if i%3 == 0 {
+					ct.Delete(key)
+				}
+				if i%50 == 0 {
+					ct.DeleteSubtree(key[:2])
+				}
+			}
+		}(w)
+	}
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for i := 0; i < perG; i++ {
+				ct.Get(hashKey(r*perG + i))
+				ct.MatchSubtree(hashKey(i)[:1])
+				if i%25 == 0 {
+					n := 0
+					ct.Visit(func(_ []byte, _ *Item) error {
+						n++
+						return nil
+					})
+					ct.VisitSubtree(hashKey(i)[:1], func(_ []byte, _ *Item) error {
+						return ErrSkipSubtree
+					})
+				}
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	n := 0
+	ct.Visit(func(key []byte, item *Item) error {
+		if got := ct.Get(key); got != item {
+			t.Fatalf("key %x: want %v, got %v", key, item, got)
+		}
+		n++
+		return nil
+	})
+	if n != ct.Size() {
+		t.Fatalf("visited %d items, Size returned %d", n, ct.Size())
+	}
+}
+
+// Walking a plain trie must not modify it, so concurrent readers are safe.
+func TestTrieConcurrentReaders(t *testing.T) {
+	trie := newHashTrie(2000)
+	var wg sync.WaitGroup
+	for r := 0; r < 8; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			trie.Visit(func(key []byte, item *Item) error {
+				if trie.Get(key) != item {
+					t.Errorf("key %x: lookup mismatch", key)
+				}
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+}
+
+func TestConcurrentTrieReadOptions(t *testing.T) {
+	saved := NewTrie(WithMaxPrefixPerNode(64))
+	for i := 0; i < 100; i++ {
+		key := bytes.Repeat(hashKey(i)[:1], 60)
+		key[59] = byte(i)
+		saved.Insert(key, &Item{Pos: uint64(i)})
+	}
+	filename := filepath.Join(t.TempDir(), "h1")
+	if err := saved.SaveToFile(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	// An empty trie takes over the options of the file.
+	ct := NewConcurrentTrie()
+	if err := ct.ReadFromFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, saved, ct.trie)
+	assertShape(t, ct.trie, 64, defaultMaxChildrenPerSparseNode)
+
+	// One holding items keeps its own.
+	ct = NewConcurrentTrie()
+	ct.Insert([]byte("a"), &Item{})
+	if err := ct.ReadFromFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	if err := ct.trie.Validate(); err != nil || ct.Size() != saved.Size()+1 {
+		t.Fatalf("%d items: %v", ct.Size(), err)
+	}
+	assertShape(t, ct.trie, defaultMaxPrefixPerNode, defaultMaxChildrenPerSparseNode)
+}
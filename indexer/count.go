@@ -0,0 +1,93 @@
+package indexer
+
+// Every node keeps the number of items in its subtree, which lets the trie be
+// addressed by position. The counts are maintained by the methods modifying
+// the trie, so the exported fields must not be changed directly.
+
+// CountPrefix returns the number of items whose key starts with prefix.
+func (trie *TrieOf[V]) CountPrefix(prefix []byte) int {
+	// Nil prefix not allowed.
+	if prefix == nil {
+		panic(ErrNilPrefix)
+	}
+
+	_, root, found, _ := trie.findSubtree(prefix)
+	if !found {
+		return 0
+	}
+	return root.count
+}
+
+// Rank returns the number of items whose key is smaller than key, which is
+// the position key has or would have in Walk order.
+func (trie *TrieOf[V]) Rank(key []byte) int {
+	// Nil key not allowed.
+	if key == nil {
+		panic(ErrNilPrefix)
+	}
+
+	rank := 0
+	node := trie
+	for {
+		common := node.longestCommonPrefixLength(key)
+		if common < len(node.Prefix) {
+			if common < len(key) && node.Prefix[common] < key[common] {
+				// The whole subtree sorts before key.
+				rank += node.count
+			}
+			return rank
+		}
+
+		key = key[common:]
+		if len(key) == 0 {
+			return rank
+		}
+
+		// The item of this node is a proper prefix of key.
+		if node.Item != nil {
+			rank++
+		}
+		rank += node.Children.countBefore(key[0])
+
+		child := node.Children.next(key[0])
+		if child == nil {
+			return rank
+		}
+		node = child
+	}
+}
+
+// Select returns the i-th item in Walk order together with its key, or nil
+// when i is out of range.
+func (trie *TrieOf[V]) Select(i int) (key []byte, item *V) {
+	if i < 0 || i >= trie.count {
+		return nil, nil
+	}
+
+	node := trie
+	// The empty key is returned as such rather than nil.
+	key = append([]byte{}, node.Prefix...)
+	for {
+		if node.Item != nil {
+			if i == 0 {
+				return key, node.Item
+			}
+			i--
+		}
+		node, i = node.Children.childAt(i)
+		key = append(key, node.Prefix...)
+	}
+}
+
+// addCount adds delta to the counts of the nodes on the path to key.
+func (trie *TrieOf[V]) addCount(key []byte, delta int) {
+	node := trie
+	for {
+		node.count += delta
+		key = key[node.longestCommonPrefixLength(key):]
+		if len(key) == 0 {
+			return
+		}
+		node = node.Children.next(key[0])
+	}
+}
@@ -0,0 +1,143 @@
+package indexer
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// sortedKeys returns the keys of the trie in Walk order.
+func sortedKeys(trie *Trie) [][]byte {
+	var keys [][]byte
+	trie.Walk(nil, func(key []byte, _ *Item) error {
+		keys = append(keys, append([]byte{}, key...))
+		return nil
+	})
+	return keys
+}
+
+func assertCounts(t *testing.T, trie *Trie) {
+	t.Helper()
+	if err := trie.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	keys := sortedKeys(trie)
+	if trie.Size() != len(keys) {
+		t.Fatalf("size %d, walked %d items", trie.Size(), len(keys))
+	}
+
+	for i, key := range keys {
+		if rank := trie.Rank(key); rank != i {
+			t.Fatalf("key %x: want rank %d, got %d", key, i, rank)
+		}
+		got, item := trie.Select(i)
+		if !bytes.Equal(got, key) || item != trie.Get(key) {
+			t.Fatalf("select %d: want %x, got %x", i, key, got)
+		}
+		for n := 0; n <= len(key); n++ {
+			prefix := key[:n]
+			want := sort.Search(len(keys), func(j int) bool { return bytes.Compare(keys[j], prefix) >= 0 })
+			if rank := trie.Rank(prefix); rank != want {
+				t.Fatalf("prefix %x: want rank %d, got %d", prefix, want, rank)
+			}
+		}
+	}
+	if key, item := trie.Select(len(keys)); key != nil || item != nil {
+		t.Fatalf("select past the end returned %x", key)
+	}
+}
+
+func TestCountsFollowModifications(t *testing.T) {
+	rnd := rand.New(rand.NewSource(12))
+	trie, keys := randomTrie(rnd, 300)
+	assertCounts(t, trie)
+
+	for i := 0; i < 300; i++ {
+		key := keys[rnd.Intn(len(keys))]
+		switch rnd.Intn(4) {
+		case 0:
+			trie.Delete(key)
+		case 1:
+			trie.DeleteSubtree(key[:len(key)-1])
+		case 2:
+			trie.Set(key, &Item{Pos: uint64(i)})
+		default:
+			trie.Insert(append(append([]byte{}, key...), 7), &Item{})
+		}
+		if i%30 == 0 {
+			assertCounts(t, trie)
+		}
+	}
+	assertCounts(t, trie)
+}
+
+func TestCountPrefix(t *testing.T) {
+	trie, _ := randomTrie(rand.New(rand.NewSource(13)), 1000)
+	keys := sortedKeys(trie)
+
+	for _, prefix := range [][]byte{{}, {0}, {60}, {60, 120}, {0, 0, 0}, {180, 180}, {1}} {
+		want := 0
+		for _, key := range keys {
+			if bytes.HasPrefix(key, prefix) {
+				want++
+			}
+		}
+		if got := trie.CountPrefix(prefix); got != want {
+			t.Fatalf("prefix %x: want %d, got %d", prefix, want, got)
+		}
+	}
+}
+
+func TestCountsAfterLoadAndMerge(t *testing.T) {
+	rnd := rand.New(rand.NewSource(14))
+	a, _ := randomTrie(rnd, 500)
+	b, _ := randomTrie(rnd, 500)
+
+	data, err := a.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewTrie()
+	if err := loaded.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	assertCounts(t, loaded)
+
+	loaded.Merge(b, func(_ []byte, _, _ *Item) *Item { return nil })
+	assertCounts(t, loaded)
+
+	v1 := Persist(loaded)
+	v2 := v1.Set([]byte{1, 2, 3}, &Item{})
+	if v2.Size() != v1.Size()+1 {
+		t.Fatalf("want %d items, got %d", v1.Size()+1, v2.Size())
+	}
+}
+
+func TestRankSelectChildLists(t *testing.T) {
+	rnd := rand.New(rand.NewSource(14))
+	for _, n := range []int{10, 40, 200} {
+		trie := NewTrie()
+		for _, b := range rnd.Perm(256)[:n] {
+			trie.Insert([]byte{byte(b)}, &Item{})
+			trie.Insert([]byte{byte(b), 'x'}, &Item{})
+		}
+		assertCounts(t, trie)
+
+		// Only the key returned by Select is allocated.
+		if allocs := testing.AllocsPerRun(10, func() { trie.Select(trie.Size() - 1) }); allocs > 1 {
+			t.Fatalf("%s: Select allocates %.0f times", childKind(trie.Children), allocs)
+		}
+		if allocs := testing.AllocsPerRun(10, func() { trie.Rank([]byte{255, 'y'}) }); allocs != 0 {
+			t.Fatalf("%s: Rank allocates %.0f times", childKind(trie.Children), allocs)
+		}
+	}
+}
+
+func BenchmarkSelect(b *testing.B) {
+	trie := newHashTrie(100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trie.Select(i % 100000)
+	}
+}
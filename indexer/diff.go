@@ -0,0 +1,142 @@
+package indexer
+
+import "bytes"
+
+type (
+	// DiffFuncOf is called by Diff for every key whose item differs between
+	// the tries. old is nil for added keys, new is nil for removed keys.
+	DiffFuncOf[V any] func(key []byte, old, new *V) error
+
+	// DiffFunc is the Item based instantiation of DiffFuncOf.
+	DiffFunc = DiffFuncOf[Item]
+)
+
+// Diff calls fn in ascending key order for every key added, removed or
+// modified between a and b. Items are considered modified when their
+// encodings by the value codec of a differ, or, without a codec, when they
+// are different pointers. The key passed to fn is only valid during the call.
+//
+// Both tries are walked in lockstep. Subtrees shared by the tries, as between
+// versions of a PersistentTrie, and subtrees whose cached Merkle hashes match
+// are skipped without being visited. Returning an error from fn stops Diff and
+// returns that error.
+func Diff[V any](a, b *TrieOf[V], fn DiffFuncOf[V]) error {
+	d := &differ[V]{fn: fn}
+	if codec, err := a.codec(); err == nil {
+		d.codec = codec
+	}
+	aLabel, aNode := a.label(nil)
+	bLabel, bNode := b.label(nil)
+	return d.diff(nil, diffPosition[V]{aNode, aLabel}, diffPosition[V]{bNode, bLabel})
+}
+
+type differ[V any] struct {
+	fn    DiffFuncOf[V]
+	codec ValueCodec[V]
+}
+
+// diffPosition is a point in a trie, pending bytes above node. The nodes are
+// the ones returned by label, so positions do not depend on how the tries
+// happen to split prefixes.
+type diffPosition[V any] struct {
+	node    *TrieOf[V]
+	pending []byte
+}
+
+// diffEdge leads from a position to the next node below it.
+type diffEdge[V any] struct {
+	label []byte
+	node  *TrieOf[V]
+}
+
+func (p diffPosition[V]) item() *V {
+	if len(p.pending) != 0 {
+		return nil
+	}
+	return p.node.Item
+}
+
+func (p diffPosition[V]) edges() []diffEdge[V] {
+	if len(p.pending) != 0 {
+		return []diffEdge[V]{{p.pending, p.node}}
+	}
+	var edges []diffEdge[V]
+	for _, child := range p.node.Children.appendChildren(nil) {
+		label, node := child.label(nil)
+		edges = append(edges, diffEdge[V]{label, node})
+	}
+	return edges
+}
+
+// diff reports the differences below two positions at key.
+func (d *differ[V]) diff(key []byte, a, b diffPosition[V]) error {
+	if bytes.Equal(a.pending, b.pending) && a.node.sameAs(b.node) {
+		return nil
+	}
+
+	if err := d.diffItems(key, a.item(), b.item()); err != nil {
+		return err
+	}
+
+	aEdges, bEdges := a.edges(), b.edges()
+	for len(aEdges) != 0 || len(bEdges) != 0 {
+		switch {
+		case len(bEdges) == 0 || len(aEdges) != 0 && aEdges[0].label[0] < bEdges[0].label[0]:
+			if err := d.report(key, aEdges[0], true); err != nil {
+				return err
+			}
+			aEdges = aEdges[1:]
+
+		case len(aEdges) == 0 || bEdges[0].label[0] < aEdges[0].label[0]:
+			if err := d.report(key, bEdges[0], false); err != nil {
+				return err
+			}
+			bEdges = bEdges[1:]
+
+		default:
+			ea, eb := aEdges[0], bEdges[0]
+			common := commonPrefixLength(ea.label, eb.label)
+			err := d.diff(append(key, ea.label[:common]...),
+				diffPosition[V]{ea.node, ea.label[common:]},
+				diffPosition[V]{eb.node, eb.label[common:]})
+			if err != nil {
+				return err
+			}
+			aEdges, bEdges = aEdges[1:], bEdges[1:]
+		}
+	}
+	return nil
+}
+
+func (d *differ[V]) diffItems(key []byte, old, new *V) error {
+	switch {
+	case old == new:
+		return nil
+	case old == nil || new == nil:
+		return d.fn(key, old, new)
+	case d.codec != nil && bytes.Equal(d.codec.AppendValue(nil, old), d.codec.AppendValue(nil, new)):
+		return nil
+	}
+	return d.fn(key, old, new)
+}
+
+// report calls fn for every item below the edge as removed or added.
+func (d *differ[V]) report(key []byte, edge diffEdge[V], removed bool) error {
+	prefix := append(key[:len(key):len(key)], edge.label...)
+	return edge.node.Walk(prefix, func(key []byte, item *V) error {
+		if removed {
+			return d.fn(key, item, nil)
+		}
+		return d.fn(key, nil, item)
+	})
+}
+
+// sameAs reports whether the node is known to hold the same items as other
+// without visiting them.
+func (trie *TrieOf[V]) sameAs(other *TrieOf[V]) bool {
+	if trie == other {
+		return true
+	}
+	sum, otherSum := trie.cachedHash(), other.cachedHash()
+	return sum != nil && otherSum != nil && *sum == *otherSum
+}
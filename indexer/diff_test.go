@@ -0,0 +1,134 @@
+package indexer
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// expectedDiff lists the changes between a and b computed from their items.
+func expectedDiff(a, b *Trie) []string {
+	items := func(trie *Trie) map[string]Item {
+		m := make(map[string]Item)
+		trie.Walk(nil, func(key []byte, item *Item) error {
+			m[string(key)] = *item
+			return nil
+		})
+		return m
+	}
+	am, bm := items(a), items(b)
+
+	var changes []string
+	for key, old := range am {
+		if new, ok := bm[key]; !ok {
+			changes = append(changes, fmt.Sprintf("-%x", key))
+		} else if new != old {
+			changes = append(changes, fmt.Sprintf("~%x", key))
+		}
+	}
+	for key := range bm {
+		if _, ok := am[key]; !ok {
+			changes = append(changes, fmt.Sprintf("+%x", key))
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i][1:] < changes[j][1:] })
+	return changes
+}
+
+func diffChanges(t *testing.T, a, b *Trie) []string {
+	t.Helper()
+	var changes []string
+	err := Diff(a, b, func(key []byte, old, new *Item) error {
+		switch {
+		case new == nil:
+			changes = append(changes, fmt.Sprintf("-%x", key))
+		case old == nil:
+			changes = append(changes, fmt.Sprintf("+%x", key))
+		default:
+			changes = append(changes, fmt.Sprintf("~%x", key))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return changes
+}
+
+func mutate(rnd *rand.Rand, trie *Trie, keys [][]byte, n int) {
+	for i := 0; i < n; i++ {
+		key := keys[rnd.Intn(len(keys))]
+		switch rnd.Intn(3) {
+		case 0:
+			trie.Delete(key)
+		case 1:
+			trie.Set(key, &Item{Pos: uint64(rnd.Intn(1000))})
+		default:
+			key = append(append([]byte{}, key...), byte(rnd.Intn(256)))
+			trie.Insert(key, &Item{Length: 1})
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	rnd := rand.New(rand.NewSource(9))
+	for _, n := range []int{0, 1, 10, 200} {
+		a, keys := randomTrie(rnd, 1000)
+		b := a.Clone()
+		if len(keys) != 0 {
+			mutate(rnd, b, keys, n)
+		}
+
+		want := expectedDiff(a, b)
+		if got := diffChanges(t, a, b); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("%d changes: want %v, got %v", n, want, got)
+		}
+		if got, want := diffChanges(t, b, a), expectedDiff(b, a); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("%d changes reversed: want %v, got %v", n, want, got)
+		}
+	}
+
+	a, _ := randomTrie(rnd, 100)
+	if got := diffChanges(t, a, NewTrie()); len(got) != a.Size() {
+		t.Fatalf("want %d removals, got %d", a.Size(), len(got))
+	}
+}
+
+func TestDiffLoadedTrie(t *testing.T) {
+	rnd := rand.New(rand.NewSource(10))
+	a, keys := randomTrie(rnd, 1000)
+	filename := filepath.Join(t.TempDir(), "h1")
+	if err := a.SaveToFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewTrie()
+	if err := loaded.ReadFromFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	if got := diffChanges(t, a, loaded); len(got) != 0 {
+		t.Fatalf("unexpected changes %v", got)
+	}
+
+	mutate(rnd, loaded, keys, 50)
+	mustRoot(t, a)
+	mustRoot(t, loaded)
+	if got, want := diffChanges(t, a, loaded), expectedDiff(a, loaded); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+}
+
+func TestPersistentDiff(t *testing.T) {
+	v1 := Persist(newHashTrie(1000))
+	v2 := v1.Set([]byte("extra"), &Item{Pos: 1})
+
+	var changes []string
+	v1.Diff(v2, func(key []byte, old, new *Item) error {
+		changes = append(changes, string(key))
+		return nil
+	})
+	if len(changes) != 1 || changes[0] != "extra" {
+		t.Fatalf("unexpected changes %q", changes)
+	}
+}
@@ -0,0 +1,210 @@
+package indexer
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Names of the child list kinds used by WriteDOT and the JSON tree.
+const (
+	kindSparse  = "sparse"
+	kindIndexed = "indexed"
+	kindDense   = "dense"
+)
+
+// childListKind returns the kind of a child list.
+func childListKind[V any](list ChildListOf[V]) string {
+	switch list.(type) {
+	case *IndexedChildListOf[V]:
+		return kindIndexed
+	case *DenseChildListOf[V]:
+		return kindDense
+	default:
+		return kindSparse
+	}
+}
+
+// WriteDOT renders the nodes of the trie as a Graphviz digraph. Every node is
+// labelled with its prefix in hex, the kind of its child list and its item.
+func (trie *TrieOf[V]) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph trie {")
+	fmt.Fprintln(bw, "\tnode [shape=box, fontname=monospace];")
+
+	id := 0
+	var write func(node *TrieOf[V]) int
+	write = func(node *TrieOf[V]) int {
+		n := id
+		id++
+		label := fmt.Sprintf("%x\n%s %d", node.Prefix, childListKind(node.Children), node.Children.length())
+		if node.Item != nil {
+			label += fmt.Sprintf("\n%+v", *node.Item)
+		}
+		fmt.Fprintf(bw, "\tn%d [label=%s];\n", n, strconv.Quote(label))
+		for _, child := range node.Children.appendChildren(nil) {
+			fmt.Fprintf(bw, "\tn%d -> n%d [label=\"%02x\"];\n", n, write(child), child.Prefix[0])
+		}
+		return n
+	}
+	write(trie)
+
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// jsonTrie is the JSON form of a trie written by MarshalJSON.
+type jsonTrie[V any] struct {
+	MaxPrefixPerNode         int          `json:"maxPrefixPerNode"`
+	MaxChildrenPerSparseNode int          `json:"maxChildrenPerSparseNode"`
+	CompressionLevel         int          `json:"compressionLevel"`
+	Root                     *jsonNode[V] `json:"root"`
+}
+
+// jsonNode is the JSON form of a single node. The prefix is hex encoded.
+type jsonNode[V any] struct {
+	Prefix   string         `json:"prefix"`
+	Item     *V             `json:"item,omitempty"`
+	Kind     string         `json:"kind,omitempty"`
+	Children []*jsonNode[V] `json:"children,omitempty"`
+}
+
+// MarshalJSON encodes the trie as a tree of its nodes together with its
+// options. Items are encoded with encoding/json. Unlike Marshal the output
+// keeps the exact node structure, UnmarshalJSON restores it.
+func (trie *TrieOf[V]) MarshalJSON() ([]byte, error) {
+	s := defaultSettings()
+	if trie.cfg != nil {
+		s = trie.cfg.settings
+	}
+	return json.Marshal(&jsonTrie[V]{
+		MaxPrefixPerNode:         s.maxPrefixPerNode,
+		MaxChildrenPerSparseNode: s.maxChildrenPerSparseNode,
+		CompressionLevel:         s.compressionLevel,
+		Root:                     trie.jsonNode(),
+	})
+}
+
+func (trie *TrieOf[V]) jsonNode() *jsonNode[V] {
+	node := &jsonNode[V]{
+		Prefix: hex.EncodeToString(trie.Prefix),
+		Item:   trie.Item,
+	}
+	if trie.Children.length() != 0 {
+		node.Kind = childListKind(trie.Children)
+		for _, child := range trie.Children.appendChildren(nil) {
+			node.Children = append(node.Children, child.jsonNode())
+		}
+	}
+	return node
+}
+
+// UnmarshalJSON replaces the trie with the tree encoded by MarshalJSON. The
+// trie takes over the options stored along, its value codec is kept.
+func (trie *TrieOf[V]) UnmarshalJSON(data []byte) error {
+	var tree jsonTrie[V]
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return err
+	}
+	if tree.Root == nil {
+		return fmt.Errorf("%w: missing root", ErrInvalidTree)
+	}
+	s := settings{
+		maxPrefixPerNode:         tree.MaxPrefixPerNode,
+		maxChildrenPerSparseNode: tree.MaxChildrenPerSparseNode,
+		compressionLevel:         tree.CompressionLevel,
+	}
+	if err := s.validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTree, err)
+	}
+
+	cfg := &config[V]{codec: defaultCodec[V]()}
+	if trie.cfg != nil {
+		cfg = trie.cfg
+	}
+	root, err := tree.Root.trie(cfg.withSettings(s), true)
+	if err != nil {
+		return err
+	}
+	if root.Empty() {
+		root.Prefix = nil
+	}
+	*trie = *root
+	return nil
+}
+
+// trie converts the node and its descendants back into trie nodes.
+func (node *jsonNode[V]) trie(cfg *config[V], root bool) (*TrieOf[V], error) {
+	prefix, err := hex.DecodeString(node.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTree, err)
+	}
+	switch {
+	case len(prefix) > cfg.maxPrefixPerNode:
+		return nil, fmt.Errorf("%w: prefix %s longer than %d", ErrInvalidTree, node.Prefix, cfg.maxPrefixPerNode)
+	case !root && len(prefix) == 0:
+		return nil, fmt.Errorf("%w: empty prefix below the root", ErrInvalidTree)
+	case !root && node.Item == nil && len(node.Children) == 0:
+		return nil, fmt.Errorf("%w: empty node %s", ErrInvalidTree, node.Prefix)
+	}
+
+	trie := &TrieOf[V]{Prefix: prefix, Item: node.Item, cfg: cfg}
+	if trie.Item != nil {
+		trie.count++
+	}
+	children := make(TriesOf[V], 0, len(node.Children))
+	for _, c := range node.Children {
+		if c == nil {
+			return nil, fmt.Errorf("%w: null child of %s", ErrInvalidTree, node.Prefix)
+		}
+		child, err := c.trie(cfg, false)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(children); n != 0 && children[n-1].Prefix[0] >= child.Prefix[0] {
+			return nil, fmt.Errorf("%w: children of %s out of order", ErrInvalidTree, node.Prefix)
+		}
+		children = append(children, child)
+		trie.count += child.count
+	}
+	if trie.Children, err = newChildListOfKind(node.Kind, children, cfg.maxChildrenPerSparseNode); err != nil {
+		return nil, err
+	}
+	return trie, nil
+}
+
+// newChildListOfKind returns a child list of the given kind holding children,
+// which must be sorted.
+func newChildListOfKind[V any](kind string, children TriesOf[V], max int) (ChildListOf[V], error) {
+	switch {
+	case (kind == "" || kind == kindSparse) && len(children) <= max:
+		return newChildList(children, max), nil
+
+	case kind == kindIndexed && len(children) <= maxIndexedChildren:
+		list := &IndexedChildListOf[V]{max: max}
+		for _, child := range children {
+			list.put(child)
+		}
+		return list, nil
+
+	case kind == kindDense:
+		list := &DenseChildListOf[V]{NumChildren: len(children), max: max}
+		for _, child := range children {
+			list.Children[child.Prefix[0]] = child
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("%w: %d children in a %q list", ErrInvalidTree, len(children), kind)
+}
+
+// defaultCodec returns ItemCodec for tries of Item and nil otherwise.
+func defaultCodec[V any]() ValueCodec[V] {
+	codec, _ := any(ItemCodec{}).(ValueCodec[V])
+	return codec
+}
+
+var ErrInvalidTree = errors.New("invalid trie structure")
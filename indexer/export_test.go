@@ -0,0 +1,118 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	trie := newHashTrie(500)
+	keys := sortedKeys(trie)
+	for _, key := range keys[:300] {
+		trie.Delete(key)
+	}
+	trie.Insert([]byte{}, &Item{Pos: 7})
+
+	data, err := json.Marshal(trie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewTrie()
+	if err := json.Unmarshal(data, loaded); err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, trie, loaded)
+	assertCounts(t, loaded)
+	if !bytes.Equal(mustRoot(t, trie), mustRoot(t, loaded)) {
+		t.Fatal("root hash changed")
+	}
+	if kind := childListKind(loaded.Children); kind != childListKind(trie.Children) {
+		t.Fatalf("root list kind changed from %s to %s", childListKind(trie.Children), kind)
+	}
+
+	again, err := json.Marshal(loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Fatal("structure changed by the round trip")
+	}
+
+	var zero Trie
+	if err := json.Unmarshal(data, &zero); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zero.Marshal(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJSONKeepsOptions(t *testing.T) {
+	trie := NewTrie(WithMaxPrefixPerNode(2), WithMaxChildrenPerSparseNode(3))
+	trie.Insert([]byte("abcdef"), &Item{Pos: 1})
+	data, err := json.Marshal(trie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewTrie()
+	if err := json.Unmarshal(data, loaded); err != nil {
+		t.Fatal(err)
+	}
+	loaded.Insert([]byte("abcxyz"), &Item{Pos: 2})
+	assertShape(t, loaded, 2, 3)
+	if loaded.Get([]byte("abcdef")) == nil {
+		t.Fatal("item lost")
+	}
+
+	empty := NewTrie()
+	if err := json.Unmarshal([]byte(`{"maxPrefixPerNode":32,"maxChildrenPerSparseNode":16,"root":{"prefix":""}}`), empty); err != nil {
+		t.Fatal(err)
+	}
+	empty.Insert([]byte("key"), &Item{})
+	if empty.Get([]byte("key")) == nil || empty.Size() != 1 {
+		t.Fatal("insert into an unmarshalled empty trie failed")
+	}
+}
+
+func TestJSONRejectsInvalidTrees(t *testing.T) {
+	head := `{"maxPrefixPerNode":32,"maxChildrenPerSparseNode":2,"root":`
+	cases := map[string]string{
+		"missing root":  `{"maxPrefixPerNode":32,"maxChildrenPerSparseNode":2}`,
+		"bad options":   `{"maxPrefixPerNode":0,"maxChildrenPerSparseNode":2,"root":{"prefix":""}}`,
+		"bad hex":       head + `{"prefix":"zz"}}`,
+		"empty child":   head + `{"prefix":"","children":[{"prefix":"01"}]}}`,
+		"empty prefix":  head + `{"prefix":"","children":[{"prefix":"","item":{}}]}}`,
+		"unordered":     head + `{"prefix":"","children":[{"prefix":"02","item":{}},{"prefix":"01","item":{}}]}}`,
+		"overfull list": head + `{"prefix":"","kind":"sparse","children":[{"prefix":"01","item":{}},{"prefix":"02","item":{}},{"prefix":"03","item":{}}]}}`,
+		"unknown kind":  head + `{"prefix":"","kind":"tree","children":[{"prefix":"01","item":{}}]}}`,
+		"long prefix":   `{"maxPrefixPerNode":1,"maxChildrenPerSparseNode":2,"root":{"prefix":"0102","item":{}}}`,
+		"null child":    head + `{"prefix":"","children":[null]}}`,
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			if err := json.Unmarshal([]byte(data), NewTrie()); !errors.Is(err, ErrInvalidTree) {
+				t.Fatalf("want %v, got %v", ErrInvalidTree, err)
+			}
+		})
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	trie := NewTrie()
+	trie.Insert([]byte{0xab, 0xcd}, &Item{Pos: 1, Length: 2})
+	trie.Insert([]byte{0xab, 0xef}, &Item{Pos: 3, Length: 4})
+
+	var buf bytes.Buffer
+	if err := trie.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dot := buf.String()
+	for _, want := range []string{"digraph trie {", `"ab\nsparse 2"`, `"cd\nsparse 0\n{Pos:1 Length:2}"`, `n0 -> n2 [label="ef"]`} {
+		if !strings.Contains(dot, want) {
+			t.Fatalf("%q missing from\n%s", want, dot)
+		}
+	}
+}
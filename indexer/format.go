@@ -0,0 +1,426 @@
+package indexer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Serialized trie layout. All integers are big-endian, as written by Itos.
+//
+//	magic    8 bytes  magicNumber
+//	version  2 bytes  format version
+//	keyLen   2 bytes  length of every key in the file
+//	codec    1 byte   compression codec of the payload
+//	flags    1 byte   flag* bits
+//	count    8 bytes  number of items
+//	options  5 bytes  only with flagOptions, see below
+//	payload           blocks of (4-byte length, data) ended by an empty block
+//	checksum 4 bytes  CRC-32C of everything before it
+//
+// The payload is split into blocks so that it can be written without knowing
+// its size up front. Once decompressed it holds count records of keyLen bytes
+// of key followed by the value encoded by the ValueCodec of the trie, in Walk
+// order. For Item that is the 8-byte Pos and Length. With flagVarKeys set, the
+// key of every record is instead prefixed with its length as an unsigned
+// varint and keyLen is zero. With flagVarValues set, so is the value.
+//
+// Tries created with non-default options set flagOptions and store them right
+// after the header, so that they are loaded with the same shape:
+//
+//	maxPrefix    2 bytes  longest prefix of a node
+//	maxSparse    2 bytes  children of a node kept in a sparse list
+//	level        1 byte   zstd compression level, zero with codecNone
+//
+// Files written before the header existed are the magic number followed by a
+// bare zstd frame of 48-byte records; they are read as formatVersion0.
+//
+// formatVersion2 is the index layout written by WriteIndex and searched in
+// place by Index. It keeps the header and checksum but replaces the payload
+// with uncompressed data:
+//
+//	root     32 bytes       only with flagRoot, the Merkle root of the items
+//	fanout   256 * 8 bytes  number of records whose key starts with a byte <= i
+//	records  count * (keyLen + value size) bytes, sorted by key
+//
+// flagRoot is the only flag of the index layout. Index files written before
+// it lack the root, which is then computed from the records.
+const (
+	magicNumber = 5201314
+
+	formatVersion0 = 0
+	formatVersion1 = 1
+	formatVersion2 = 2
+
+	headerSize   = 22
+	optionsSize  = 5
+	rootSize     = 32
+	checksumSize = 4
+	maxBlockSize = 1 << 20
+
+	legacyKeyLength = 32
+	itemSize        = 16
+	fanoutSize      = 256 * 8
+)
+
+// Compression codecs of the payload.
+const (
+	codecNone = 0
+	codecZstd = 1
+)
+
+// Header flags.
+const (
+	flagVarKeys = 1 << iota
+	flagVarValues
+	flagOptions
+	flagRoot
+
+	knownFlags = flagVarKeys | flagVarValues | flagOptions | flagRoot
+)
+
+// zstdMagic starts every zstd frame. A file whose magic number is directly
+// followed by it predates the versioned header.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+type fileHeader struct {
+	version uint16
+	keyLen  uint16
+	codec   uint8
+	flags   uint8
+	count   uint64
+
+	// options are stored after the header with flagOptions.
+	options settings
+	// root is stored after the header with flagRoot.
+	root []byte
+
+	// valueSize is the size of values without flagVarValues. It is not
+	// serialized but taken from the ValueCodec.
+	valueSize int
+}
+
+func (h *fileHeader) encode() []byte {
+	b := make([]byte, headerSize)
+	binary.BigEndian.PutUint64(b[0:8], magicNumber)
+	binary.BigEndian.PutUint16(b[8:10], h.version)
+	binary.BigEndian.PutUint16(b[10:12], h.keyLen)
+	b[12] = h.codec
+	b[13] = h.flags
+	binary.BigEndian.PutUint64(b[14:22], h.count)
+	if h.flags&flagOptions != 0 {
+		b = appendUint16(b, uint16(h.options.maxPrefixPerNode))
+		b = appendUint16(b, uint16(h.options.maxChildrenPerSparseNode))
+		b = append(b, uint8(h.options.compressionLevel))
+	}
+	if h.flags&flagRoot != 0 {
+		b = append(b, h.root...)
+	}
+	return b
+}
+
+// decodeOptions parses the options following the header.
+func (h *fileHeader) decodeOptions(data []byte) error {
+	h.options = settings{
+		maxPrefixPerNode:         int(binary.BigEndian.Uint16(data[0:2])),
+		maxChildrenPerSparseNode: int(binary.BigEndian.Uint16(data[2:4])),
+		compressionLevel:         int(data[4]),
+	}
+	if err := h.options.validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+	return nil
+}
+
+// legacyHeader describes the payload of files predating the header.
+var legacyHeader = fileHeader{
+	version:   formatVersion0,
+	keyLen:    legacyKeyLength,
+	codec:     codecZstd,
+	valueSize: itemSize,
+}
+
+// isLegacy reports whether data starts with the magic number directly followed
+// by a zstd frame.
+func isLegacy(data []byte) bool {
+	return len(data) >= 12 && Stoi(data[:8]) == magicNumber && bytes.Equal(data[8:12], zstdMagic)
+}
+
+// decodeHeader parses the header at the start of data.
+func decodeHeader(data []byte) (h fileHeader, err error) {
+	if len(data) < 8 {
+		return h, ErrTruncated
+	}
+	if Stoi(data[:8]) != magicNumber {
+		return h, ErrInvalidMagic
+	}
+	if isLegacy(data) {
+		return legacyHeader, nil
+	}
+	if len(data) < headerSize {
+		return h, ErrTruncated
+	}
+	h.version = binary.BigEndian.Uint16(data[8:10])
+	h.keyLen = binary.BigEndian.Uint16(data[10:12])
+	h.codec = data[12]
+	h.flags = data[13]
+	h.count = binary.BigEndian.Uint64(data[14:22])
+	return h, h.validate()
+}
+
+func (h *fileHeader) validate() error {
+	switch h.version {
+	case formatVersion1:
+	case formatVersion2:
+		if h.codec != codecNone || h.flags&^flagRoot != 0 || h.keyLen == 0 {
+			return fmt.Errorf("%w: invalid index header", ErrCorrupted)
+		}
+	default:
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, h.version)
+	}
+	if h.codec != codecNone && h.codec != codecZstd {
+		return fmt.Errorf("%w: unknown codec %d", ErrCorrupted, h.codec)
+	}
+	if h.flags&^knownFlags != 0 {
+		return fmt.Errorf("%w: unknown flags %#x", ErrCorrupted, h.flags)
+	}
+	if h.flags&flagOptions != 0 && h.version != formatVersion1 {
+		return fmt.Errorf("%w: options in version %d", ErrCorrupted, h.version)
+	}
+	if h.flags&flagRoot != 0 && h.version != formatVersion2 {
+		return fmt.Errorf("%w: root in version %d", ErrCorrupted, h.version)
+	}
+	if h.flags&flagVarKeys != 0 && h.keyLen != 0 {
+		return fmt.Errorf("%w: key length %d with variable length keys", ErrCorrupted, h.keyLen)
+	}
+	return nil
+}
+
+// appendRecord appends the serialized form of a single item, given the
+// encoding of its value.
+func (h *fileHeader) appendRecord(dst, key, value []byte) []byte {
+	if h.flags&flagVarKeys != 0 {
+		dst = appendUvarint(dst, uint64(len(key)))
+	}
+	dst = append(dst, key...)
+	if h.flags&flagVarValues != 0 {
+		dst = appendUvarint(dst, uint64(len(value)))
+	}
+	return append(dst, value...)
+}
+
+// readRecord reads a single record. The value is read into buf, the key is
+// newly allocated. It returns io.EOF when r is exhausted exactly at a record
+// boundary.
+func (h *fileHeader) readRecord(r *bufio.Reader, buf []byte) (key, value []byte, err error) {
+	if _, err = r.Peek(1); err != nil {
+		return nil, nil, err
+	}
+	keyLen, err := h.readLength(r, flagVarKeys, uint64(h.keyLen))
+	if err != nil {
+		return nil, nil, err
+	}
+	key = make([]byte, keyLen)
+	if _, err = io.ReadFull(r, key); err != nil {
+		return nil, nil, unexpectedEOF(err)
+	}
+
+	valueLen, err := h.readLength(r, flagVarValues, uint64(h.valueSize))
+	if err != nil {
+		return nil, nil, err
+	}
+	if valueLen == 0 && h.flags&flagVarValues == 0 {
+		return nil, nil, fmt.Errorf("%w: unknown value size", ErrCorrupted)
+	}
+	if uint64(cap(buf)) < valueLen {
+		buf = make([]byte, valueLen)
+	}
+	value = buf[:valueLen]
+	if _, err = io.ReadFull(r, value); err != nil {
+		return nil, nil, unexpectedEOF(err)
+	}
+	return key, value, nil
+}
+
+// readLength reads a varint length when flag is set, fixed is returned
+// otherwise.
+func (h *fileHeader) readLength(r *bufio.Reader, flag uint8, fixed uint64) (uint64, error) {
+	if h.flags&flag == 0 {
+		return fixed, nil
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	if n > maxBlockSize {
+		return 0, fmt.Errorf("%w: field of %d bytes", ErrCorrupted, n)
+	}
+	return n, nil
+}
+
+// unexpectedEOF turns the end of input in the middle of a structure into
+// ErrTruncated.
+func unexpectedEOF(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncated
+	}
+	return err
+}
+
+// blockWriter splits the payload into blocks of at most maxBlockSize bytes.
+type blockWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func newBlockWriter(w io.Writer) *blockWriter {
+	return &blockWriter{w: w, buf: make([]byte, 4, 4+maxBlockSize)}
+}
+
+func (bw *blockWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := cap(bw.buf) - len(bw.buf)
+		if n > len(p) {
+			n = len(p)
+		}
+		bw.buf = append(bw.buf, p[:n]...)
+		p = p[n:]
+		written += n
+		if len(bw.buf) == cap(bw.buf) {
+			if err := bw.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (bw *blockWriter) flush() error {
+	if len(bw.buf) == 4 {
+		return nil
+	}
+	binary.BigEndian.PutUint32(bw.buf, uint32(len(bw.buf)-4))
+	_, err := bw.w.Write(bw.buf)
+	bw.buf = bw.buf[:4]
+	return err
+}
+
+// Close flushes the buffered data and writes the terminating block.
+func (bw *blockWriter) Close() error {
+	if err := bw.flush(); err != nil {
+		return err
+	}
+	_, err := bw.w.Write(make([]byte, 4))
+	return err
+}
+
+// blockReader reads the payload back from its blocks. It never reads past the
+// terminating block. Errors are remembered since the zstd reader on top of it
+// does not preserve them.
+type blockReader struct {
+	r    io.Reader
+	left int
+	done bool
+	err  error
+}
+
+func (br *blockReader) Read(p []byte) (int, error) {
+	if br.err != nil {
+		return 0, br.err
+	}
+	if br.left == 0 {
+		if br.done {
+			return 0, io.EOF
+		}
+		var buf [4]byte
+		if _, err := io.ReadFull(br.r, buf[:]); err != nil {
+			br.err = unexpectedEOF(err)
+			return 0, br.err
+		}
+		br.left = int(binary.BigEndian.Uint32(buf[:]))
+		if br.left == 0 {
+			br.done = true
+			return 0, io.EOF
+		}
+		if br.left > maxBlockSize {
+			br.err = fmt.Errorf("%w: block of %d bytes", ErrCorrupted, br.left)
+			return 0, br.err
+		}
+	}
+	if len(p) > br.left {
+		p = p[:br.left]
+	}
+	n, err := br.r.Read(p)
+	br.left -= n
+	if err == io.EOF {
+		if br.left == 0 {
+			err = nil
+		} else {
+			err = ErrTruncated
+		}
+	}
+	if err != nil {
+		br.err = err
+	}
+	return n, err
+}
+
+// checksumWriter computes the checksum of everything written through it.
+type checksumWriter struct {
+	w   io.Writer
+	n   int64
+	sum uint32
+}
+
+func (cw *checksumWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.sum = crc32.Update(cw.sum, crcTable, p[:n])
+	return n, err
+}
+
+// checksumReader computes the checksum of everything read through it.
+type checksumReader struct {
+	r   io.Reader
+	n   int64
+	sum uint32
+}
+
+func (cr *checksumReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	cr.sum = crc32.Update(cr.sum, crcTable, p[:n])
+	return n, err
+}
+
+func appendUint16(dst []byte, n uint16) []byte {
+	return append(dst, byte(n>>8), byte(n))
+}
+
+func appendUint32(dst []byte, n uint32) []byte {
+	return append(dst, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendUvarint(dst []byte, n uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(dst, b[:binary.PutUvarint(b[:], n)]...)
+}
+
+// Errors ----------------------------------------------------------------------
+
+var (
+	ErrInvalidMagic       = errors.New("invalid data file")
+	ErrUnsupportedVersion = errors.New("unsupported data file version")
+	ErrTruncated          = errors.New("truncated data file")
+	ErrChecksum           = errors.New("data file checksum mismatch")
+	ErrCorrupted          = errors.New("corrupted data file")
+	ErrKeyLength          = errors.New("keys of different length cannot be indexed")
+	ErrValueSize          = errors.New("values of variable size cannot be indexed")
+)
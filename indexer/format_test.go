@@ -0,0 +1,129 @@
+package indexer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/valyala/gozstd"
+)
+
+func newHashTrie(n int) *Trie {
+	trie := NewTrie()
+	for i := 0; i < n; i++ {
+		key := sha256.Sum256([]byte(strconv.Itoa(i)))
+		trie.Insert(key[:], &Item{Pos: uint64(i), Length: uint64(i * 2)})
+	}
+	return trie
+}
+
+func assertSameItems(t *testing.T, want, got *Trie) {
+	t.Helper()
+	if err := got.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if want.Size() != got.Size() {
+		t.Fatalf("size mismatch: want %d, got %d", want.Size(), got.Size())
+	}
+	want.Walk(nil, func(key []byte, item *Item) error {
+		if other := got.Get(key); other == nil || *other != *item {
+			t.Fatalf("key %x: want %v, got %v", key, item, other)
+		}
+		return nil
+	})
+}
+
+func TestFileRoundTrip(t *testing.T) {
+	trie := newHashTrie(1000)
+	filename := filepath.Join(t.TempDir(), "h1")
+	if err := trie.SaveToFile(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewTrie()
+	if err := loaded.ReadFromFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, trie, loaded)
+}
+
+func TestReadLegacyFile(t *testing.T) {
+	trie := newHashTrie(100)
+
+	var records bytes.Buffer
+	trie.Walk(nil, func(key []byte, item *Item) error {
+		records.Write(key)
+		records.Write(Itos(item.Pos))
+		records.Write(Itos(item.Length))
+		return nil
+	})
+	data := append(Itos(magicNumber), gozstd.Compress(nil, records.Bytes())...)
+
+	loaded := NewTrie()
+	if err := loaded.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, trie, loaded)
+
+	loaded = NewTrie()
+	if err := loaded.Unmarshal(data[8:]); err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, trie, loaded)
+}
+
+func TestUnmarshalRejectsDamagedData(t *testing.T) {
+	data, err := newHashTrie(100).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flipped := append([]byte{}, data...)
+	flipped[len(flipped)/2] ^= 0xff
+
+	badVersion := append([]byte{}, data...)
+	badVersion[9] = 0x7f
+
+	cases := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"truncated header", data[:headerSize-1], ErrTruncated},
+		{"truncated payload", data[:len(data)/2], ErrTruncated},
+		{"missing checksum", data[:len(data)-1], ErrTruncated},
+		{"flipped byte", flipped, ErrChecksum},
+		{"unknown version", badVersion, ErrUnsupportedVersion},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := NewTrie().Unmarshal(c.data)
+			if !errors.Is(err, c.err) {
+				t.Fatalf("want %v, got %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestVariableLengthKeys(t *testing.T) {
+	trie := NewTrie()
+	keys := []string{"0x111234", "0x111241", "0x222123", "0x2222223", "0x111222333", "", "0"}
+	for i, key := range keys {
+		trie.Insert([]byte(key), &Item{Pos: uint64(i), Length: uint64(len(key))})
+	}
+	long := bytes.Repeat([]byte{0xab}, 100)
+	trie.Insert(long, &Item{Pos: 100, Length: 100})
+
+	data, err := Marshal(trie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, trie, loaded)
+}
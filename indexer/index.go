@@ -0,0 +1,429 @@
+package indexer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"golang.org/x/exp/mmap"
+)
+
+// LookupOf is the read-only view of a block header shared by TrieOf and
+// IndexOf.
+type LookupOf[V any] interface {
+	Get(key []byte) *V
+	Size() int
+	Root() ([]byte, error)
+}
+
+// Lookup and Index are the Item based instantiations of LookupOf and IndexOf.
+type (
+	Lookup = LookupOf[Item]
+	Index  = IndexOf[Item]
+)
+
+// OpenLookup opens a header file written by either SaveToFile or
+// SaveIndexToFile. Index files are mapped into memory, everything else is
+// loaded into a Trie.
+func OpenLookup(filename string) (Lookup, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, headerSize)
+	n, err := io.ReadFull(f, buf)
+	f.Close()
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, unexpectedEOF(err)
+	}
+
+	if header, err := decodeHeader(buf[:n]); err == nil && header.version == formatVersion2 {
+		return OpenIndex(filename)
+	}
+	trie := NewTrie()
+	if err := trie.ReadFromFile(filename); err != nil {
+		return nil, err
+	}
+	return trie, nil
+}
+
+// WriteIndex writes the trie to w using the index layout, which Index can
+// search without loading it. All keys must have the same, non-zero length and
+// the value codec must have a fixed size.
+func (trie *TrieOf[V]) WriteIndex(w io.Writer) (int64, error) {
+	codec, err := trie.codec()
+	if err != nil {
+		return 0, err
+	}
+	if codec.Size() == 0 {
+		return 0, ErrValueSize
+	}
+
+	var (
+		fanout [256]uint64
+		count  uint64
+		keyLen = -1
+	)
+	err = trie.Walk(nil, func(prefix []byte, _ *V) error {
+		if keyLen == -1 {
+			keyLen = len(prefix)
+		}
+		if len(prefix) != keyLen || keyLen == 0 || keyLen > maxIndexKeyLength {
+			return ErrKeyLength
+		}
+		fanout[prefix[0]]++
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if keyLen == -1 {
+		// An empty index still needs a valid key length.
+		keyLen = legacyKeyLength
+	}
+	for i := 1; i < len(fanout); i++ {
+		fanout[i] += fanout[i-1]
+	}
+
+	root, err := trie.Root()
+	if err != nil {
+		return 0, err
+	}
+	header := fileHeader{
+		version:   formatVersion2,
+		keyLen:    uint16(keyLen),
+		codec:     codecNone,
+		flags:     flagRoot,
+		count:     count,
+		root:      root,
+		valueSize: codec.Size(),
+	}
+	cw := &checksumWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	bw.Write(header.encode())
+	for _, n := range fanout {
+		bw.Write(Itos(n))
+	}
+	var record, value []byte
+	err = trie.Walk(nil, func(prefix []byte, item *V) error {
+		value = codec.AppendValue(value[:0], item)
+		record = header.appendRecord(record[:0], prefix, value)
+		_, err := bw.Write(record)
+		return err
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		return cw.n, err
+	}
+
+	n, err := w.Write(appendUint32(nil, cw.sum))
+	return cw.n + int64(n), err
+}
+
+// SaveIndexToFile writes the trie to filename using the index layout. The
+// file is replaced atomically like by SaveToFile.
+func (trie *TrieOf[V]) SaveIndexToFile(filename string, opts ...SaveOption) error {
+	return writeFile(filename, func(w io.Writer) error {
+		_, err := trie.WriteIndex(w)
+		return err
+	}, opts)
+}
+
+// readIndexPayload reads the records of an index file, leaving cr right
+// before the checksum.
+func (trie *TrieOf[V]) readIndexPayload(cr *checksumReader, header fileHeader) error {
+	buf := make([]byte, fanoutSize)
+	if header.flags&flagRoot != 0 {
+		// The root is covered by the checksum but not needed here.
+		if _, err := io.ReadFull(cr, buf[:rootSize]); err != nil {
+			return unexpectedEOF(err)
+		}
+	}
+	if _, err := io.ReadFull(cr, buf); err != nil {
+		return unexpectedEOF(err)
+	}
+	if _, err := decodeFanout(buf, header.count); err != nil {
+		return err
+	}
+
+	codec, err := trie.codec()
+	if err != nil {
+		return err
+	}
+	if codec.Size() == 0 {
+		return ErrValueSize
+	}
+	size := int64(header.keyLen) + int64(codec.Size())
+	if header.count > uint64(1<<62/size) {
+		return fmt.Errorf("%w: %d items", ErrCorrupted, header.count)
+	}
+	records := &io.LimitedReader{R: cr, N: int64(header.count) * size}
+	err = trie.readRecords(records, header, int64(header.count))
+	if records.N != 0 {
+		return ErrTruncated
+	}
+	return err
+}
+
+func decodeFanout(buf []byte, count uint64) (fanout [256]uint64, err error) {
+	var last uint64
+	for i := range fanout {
+		fanout[i] = Stoi(buf[i*8 : i*8+8])
+		if fanout[i] < last {
+			return fanout, fmt.Errorf("%w: unsorted fanout table", ErrCorrupted)
+		}
+		last = fanout[i]
+	}
+	if last != count {
+		return fanout, fmt.Errorf("%w: fanout table does not match item count", ErrCorrupted)
+	}
+	return fanout, nil
+}
+
+const maxIndexKeyLength = 1 << 10
+
+// IndexOf is a read-only header searched directly in a memory-mapped file
+// written by SaveIndexToFile. Opening an index only reads its header and
+// fanout table, the records are paged in by the OS as lookups touch them.
+//
+// Lookups are not entirely zero-copy: the keys are compared in place in the
+// mapping, but the value of a found record is copied out to be decoded, so
+// Get allocates that copy and the decoded item.
+//
+// IndexOf is safe for concurrent use.
+type IndexOf[V any] struct {
+	reader  *mmap.ReaderAt
+	codec   ValueCodec[V]
+	keyLen  int
+	count   int
+	fanout  [256]uint64
+	records int64 // offset of the first record
+
+	// root is read from the file, or computed once for files without it.
+	root     []byte
+	rootErr  error
+	rootOnce sync.Once
+}
+
+// OpenIndex maps the index file into memory. The checksum is not verified,
+// use Verify for that.
+func OpenIndex(filename string) (*Index, error) {
+	return OpenIndexOf[Item](filename, ItemCodec{})
+}
+
+// OpenIndexOf is OpenIndex for values decoded by codec, which must have a
+// fixed size.
+func OpenIndexOf[V any](filename string, codec ValueCodec[V]) (*IndexOf[V], error) {
+	if codec == nil {
+		return nil, ErrNoCodec
+	}
+	if codec.Size() == 0 {
+		return nil, ErrValueSize
+	}
+	reader, err := mmap.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := newIndex(reader, codec)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return idx, nil
+}
+
+func newIndex[V any](reader *mmap.ReaderAt, codec ValueCodec[V]) (*IndexOf[V], error) {
+	buf := make([]byte, headerSize+rootSize+fanoutSize)
+	if reader.Len() < len(buf) {
+		buf = buf[:reader.Len()]
+	}
+	if _, err := reader.ReadAt(buf, 0); err != nil {
+		return nil, err
+	}
+	header, err := decodeHeader(buf)
+	if err != nil {
+		return nil, err
+	}
+	if header.version != formatVersion2 {
+		return nil, fmt.Errorf("%w: %d is not an index", ErrUnsupportedVersion, header.version)
+	}
+	if header.keyLen > maxIndexKeyLength {
+		return nil, fmt.Errorf("%w: key length %d", ErrCorrupted, header.keyLen)
+	}
+
+	idx := &IndexOf[V]{
+		reader:  reader,
+		codec:   codec,
+		keyLen:  int(header.keyLen),
+		count:   int(header.count),
+		records: headerSize + fanoutSize,
+	}
+	if header.flags&flagRoot != 0 {
+		idx.records += rootSize
+	}
+	size := idx.records + checksumSize + int64(header.count)*int64(idx.recordSize())
+	if header.count > uint64(1<<62/idx.recordSize()) || size > int64(reader.Len()) {
+		return nil, ErrTruncated
+	}
+	if size < int64(reader.Len()) {
+		return nil, fmt.Errorf("%w: trailing data", ErrCorrupted)
+	}
+	if header.flags&flagRoot != 0 {
+		idx.root = append([]byte{}, buf[headerSize:headerSize+rootSize]...)
+	}
+	if idx.fanout, err = decodeFanout(buf[idx.records-fanoutSize:idx.records], header.count); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// Get returns the item stored under key, or nil.
+func (idx *IndexOf[V]) Get(key []byte) *V {
+	if len(key) != idx.keyLen {
+		return nil
+	}
+
+	lo, hi := idx.bucket(key[0])
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return idx.compareKey(lo+i, key) >= 0
+	})
+	if i == hi || idx.compareKey(i, key) != 0 {
+		return nil
+	}
+	return idx.item(i, make([]byte, idx.codec.Size()))
+}
+
+// Match returns what Get(key) != nil would return.
+func (idx *IndexOf[V]) Match(key []byte) bool {
+	return idx.Get(key) != nil
+}
+
+// Size returns the number of items in the index.
+func (idx *IndexOf[V]) Size() int {
+	return idx.count
+}
+
+// Visit calls visitor on every item in ascending key order. ErrSkipSubtree has
+// no effect since every item is a leaf.
+func (idx *IndexOf[V]) Visit(visitor VisitorFuncOf[V]) error {
+	buf := make([]byte, idx.recordSize())
+	for i := 0; i < idx.count; i++ {
+		key := append([]byte{}, idx.key(i, buf)...)
+		if err := visitor(key, idx.item(i, buf)); err != nil && err != ErrSkipSubtree {
+			return err
+		}
+	}
+	return nil
+}
+
+// Root returns the Merkle root of the items, equal to that of a trie holding
+// the same items. It is stored in the file by WriteIndex. For index files
+// written before that, the first call loads the records into a temporary
+// trie and the result is kept for later calls.
+func (idx *IndexOf[V]) Root() ([]byte, error) {
+	idx.rootOnce.Do(func() {
+		if idx.root != nil {
+			return
+		}
+		builder := NewBuilderOf[V](idx.codec)
+		idx.rootErr = idx.Visit(func(key []byte, item *V) error {
+			return builder.Add(key, item)
+		})
+		if idx.rootErr == nil {
+			idx.root, idx.rootErr = builder.Trie().Root()
+		}
+	})
+	if idx.rootErr != nil {
+		return nil, idx.rootErr
+	}
+	return append([]byte{}, idx.root...), nil
+}
+
+// Verify checks the checksum of the whole file. Unlike OpenIndex it reads
+// every page of the file.
+func (idx *IndexOf[V]) Verify() error {
+	size := int64(idx.reader.Len()) - checksumSize
+	var sum uint32
+	buf := make([]byte, 64<<10)
+	for off := int64(0); off < size; {
+		n := int64(len(buf))
+		if size-off < n {
+			n = size - off
+		}
+		if _, err := idx.reader.ReadAt(buf[:n], off); err != nil {
+			return err
+		}
+		sum = crc32.Update(sum, crcTable, buf[:n])
+		off += n
+	}
+	if _, err := idx.reader.ReadAt(buf[:checksumSize], size); err != nil {
+		return err
+	}
+	if binary.BigEndian.Uint32(buf) != sum {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// Close unmaps the file. The index must not be used afterwards.
+func (idx *IndexOf[V]) Close() error {
+	return idx.reader.Close()
+}
+
+func (idx *IndexOf[V]) recordSize() int {
+	return idx.keyLen + idx.codec.Size()
+}
+
+// bucket returns the range of records whose key starts with b.
+func (idx *IndexOf[V]) bucket(b byte) (lo, hi int) {
+	if b != 0 {
+		lo = int(idx.fanout[b-1])
+	}
+	return lo, int(idx.fanout[b])
+}
+
+func (idx *IndexOf[V]) offset(i int) int64 {
+	return idx.records + int64(i)*int64(idx.recordSize())
+}
+
+// key reads the key of the i-th record into buf.
+func (idx *IndexOf[V]) key(i int, buf []byte) []byte {
+	buf = buf[:idx.keyLen]
+	idx.reader.ReadAt(buf, idx.offset(i))
+	return buf
+}
+
+// compareKey compares the key of the i-th record with key, which has the
+// length of the keys, without copying it out of the mapping.
+func (idx *IndexOf[V]) compareKey(i int, key []byte) int {
+	off := int(idx.offset(i))
+	for j, b := range key {
+		if c := idx.reader.At(off + j); c != b {
+			if c < b {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// item decodes the value of the i-th record, or returns nil when it cannot be
+// decoded.
+func (idx *IndexOf[V]) item(i int, buf []byte) *V {
+	buf = buf[:idx.codec.Size()]
+	idx.reader.ReadAt(buf, idx.offset(i)+int64(idx.keyLen))
+	item, err := idx.codec.DecodeValue(buf)
+	if err != nil {
+		return nil
+	}
+	return item
+}
@@ -0,0 +1,150 @@
+package indexer
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIndexLookup(t *testing.T) {
+	trie := newHashTrie(5000)
+	filename := filepath.Join(t.TempDir(), "h1")
+	if err := trie.SaveIndexToFile(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := OpenIndex(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	if err := idx.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if idx.Size() != trie.Size() {
+		t.Fatalf("want %d items, got %d", trie.Size(), idx.Size())
+	}
+
+	trie.Walk(nil, func(key []byte, item *Item) error {
+		if got := idx.Get(key); got == nil || *got != *item {
+			t.Fatalf("key %x: want %v, got %v", key, item, got)
+		}
+		missing := append([]byte{}, key...)
+		missing[len(missing)-1] ^= 0xff
+		if trie.Get(missing) == nil && idx.Get(missing) != nil {
+			t.Fatalf("key %x: unexpected item", missing)
+		}
+		return nil
+	})
+	if idx.Get([]byte("short")) != nil {
+		t.Fatal("unexpected item for a short key")
+	}
+
+	// Only the value of the found record is copied and decoded.
+	key := make([]byte, idx.keyLen)
+	trie.Walk(nil, func(prefix []byte, _ *Item) error {
+		copy(key, prefix)
+		return ErrSkipSubtree
+	})
+	if allocs := testing.AllocsPerRun(10, func() { idx.Get(key) }); allocs > 2 {
+		t.Fatalf("Get allocates %v times", allocs)
+	}
+
+	var prev []byte
+	idx.Visit(func(key []byte, _ *Item) error {
+		if prev != nil && bytes.Compare(prev, key) >= 0 {
+			t.Fatalf("keys out of order: %x >= %x", prev, key)
+		}
+		prev = key
+		return nil
+	})
+}
+
+func TestIndexFileAsTrie(t *testing.T) {
+	trie := newHashTrie(500)
+	dir := t.TempDir()
+	indexFile, trieFile := filepath.Join(dir, "index"), filepath.Join(dir, "trie")
+	if err := trie.SaveIndexToFile(indexFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := trie.SaveToFile(trieFile); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewTrie()
+	if err := loaded.ReadFromFile(indexFile); err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, trie, loaded)
+
+	for filename, wantIndex := range map[string]bool{indexFile: true, trieFile: false} {
+		lookup, err := OpenLookup(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := lookup.(*Index); ok != wantIndex {
+			t.Fatalf("%s: unexpected lookup type %T", filename, lookup)
+		}
+		if lookup.Size() != trie.Size() {
+			t.Fatalf("%s: want %d items, got %d", filename, trie.Size(), lookup.Size())
+		}
+	}
+}
+
+func TestIndexRejectsDamagedFiles(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "h1")
+	if err := newHashTrie(100).SaveIndexToFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	truncated := filepath.Join(dir, "truncated")
+	os.WriteFile(truncated, data[:len(data)-1], 0644)
+	if _, err := OpenIndex(truncated); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("want %v, got %v", ErrTruncated, err)
+	}
+
+	flipped := filepath.Join(dir, "flipped")
+	data[len(data)-10] ^= 0xff
+	os.WriteFile(flipped, data, 0644)
+	idx, err := OpenIndex(flipped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	if err := idx.Verify(); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("want %v, got %v", ErrChecksum, err)
+	}
+}
+
+func BenchmarkIndexGet(b *testing.B) {
+	trie := newHashTrie(100000)
+	filename := filepath.Join(b.TempDir(), "h1")
+	if err := trie.SaveIndexToFile(filename); err != nil {
+		b.Fatal(err)
+	}
+	idx, err := OpenIndex(filename)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer idx.Close()
+
+	var keys [][]byte
+	trie.Walk(nil, func(key []byte, _ *Item) error {
+		keys = append(keys, append([]byte{}, key...))
+		return nil
+	})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if idx.Get(keys[i%len(keys)]) == nil {
+			b.Fatal("key not found")
+		}
+	}
+}
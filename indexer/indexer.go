@@ -6,15 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"os"
 	"strings"
-
-	"github.com/valyala/gozstd"
-)
-
-const (
-	defaultMaxPrefixPerNode         = 32
-	defaultMaxChildrenPerSparseNode = 32
+	"sync/atomic"
+	"unsafe"
 )
 
 type (
@@ -22,107 +17,134 @@ type (
 		Pos    uint64
 		Length uint64
 	}
-	VisitorFunc func(prefix []byte, item *Item) error
+	VisitorFuncOf[V any] func(prefix []byte, item *V) error
+
+	// Trie, VisitorFunc and ChildList are the Item based instantiations of
+	// the generic types, kept for the existing callers.
+	Trie        = TrieOf[Item]
+	VisitorFunc = VisitorFuncOf[Item]
+	ChildList   = ChildListOf[Item]
 )
 
-// Trie is not thread-safe.
-type Trie struct {
+// TrieOf is a trie storing values of type V. It is not thread-safe.
+type TrieOf[V any] struct {
 	Prefix []byte
-	Item   *Item
+	Item   *V
+
+	Children ChildListOf[V]
+
+	cfg   *config[V]
+	hash  unsafe.Pointer // *[sha256.Size]byte, see merkle.go
+	count int            // number of items in the subtree, see count.go
+}
 
-	Children ChildList
+// Trie constructor. See options.go for the available options.
+func NewTrie(opts ...Option) *Trie {
+	return NewTrieOf[Item](ItemCodec{}, opts...)
 }
 
-// Trie constructor.
-func NewTrie() *Trie {
-	trie := &Trie{}
+// NewTrieOf returns an empty trie for values of type V, serialized with codec.
+// The codec may be nil when the trie is never serialized.
+func NewTrieOf[V any](codec ValueCodec[V], opts ...Option) *TrieOf[V] {
+	trie := &TrieOf[V]{cfg: newConfig(codec, opts)}
 
-	trie.Children = newSparseChildList(defaultMaxChildrenPerSparseNode)
+	trie.Children = newSparseChildList[V](trie.maxSparse())
 	return trie
 }
-func (trie *Trie) Marshal() ([]byte, error) {
+
+// newNode returns an empty node sharing the settings of the trie.
+func (trie *TrieOf[V]) newNode() *TrieOf[V] {
+	node := &TrieOf[V]{cfg: trie.cfg}
+
+	node.Children = newSparseChildList[V](trie.maxSparse())
+	return node
+}
+
+// Marshal serializes the trie into the versioned file format described in
+// format.go.
+func (trie *TrieOf[V]) Marshal() ([]byte, error) {
 	var buffer bytes.Buffer
-	buffer.Reset()
-	trie.Walk(nil, func(prefix []byte, item *Item) error {
-		buffer.Write(prefix)
-		buffer.Write(Itos(item.Pos))
-		buffer.Write(Itos(item.Length))
-		return nil
-	})
-	return gozstd.Compress(nil, buffer.Bytes()), nil
+	if _, err := trie.WriteTo(&buffer); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
 }
 
-func (trie *Trie) Unmarshal(data []byte) error {
+// Unmarshal inserts the items serialized in data into the trie. Besides the
+// output of Marshal it accepts the headerless zstd payload written by older
+// versions of this package.
+func (trie *TrieOf[V]) Unmarshal(data []byte) error {
 	if len(data) == 0 {
 		return fmt.Errorf("data is empty")
 	}
-	ds, err := gozstd.Decompress(nil, data)
-	if err != nil {
+	if !bytes.HasPrefix(data, Itos(magicNumber)) {
+		loaded := trie.newNode()
+		if trie.Empty() {
+			loaded.adoptSettings(defaultSettings())
+		}
+		if err := loaded.readRecords(bytes.NewReader(data), legacyHeader, -1); err != nil {
+			return err
+		}
+		trie.add(loaded)
+		return nil
+	}
+
+	r := bytes.NewReader(data)
+	if _, err := trie.ReadFrom(r); err != nil {
 		return err
 	}
-	scanner := bufio.NewScanner(bytes.NewReader(ds))
-	scanner.Split(ScanData)
-	var line, key []byte
-	for scanner.Scan() {
-		line = scanner.Bytes()
-		key = make([]byte, 32)
-		copy(key, line[:32])
-		trie.Insert(key, &Item{Pos: Stoi(line[32:40]), Length: Stoi(line[40:48])})
+	if r.Len() != 0 {
+		return fmt.Errorf("%w: trailing data", ErrCorrupted)
 	}
 	return nil
 }
 
-const magicNumber = 5201314
-
-func (trie *Trie) SaveToFile(filename string) error {
-	buffer := bytes.NewBuffer(nil)
-	buffer.Write(Itos(magicNumber))
-	ts, err := trie.Marshal()
-	if err != nil {
+// SaveToFile writes the trie to filename. The file is replaced atomically,
+// see save.go for the options.
+func (trie *TrieOf[V]) SaveToFile(filename string, opts ...SaveOption) error {
+	return writeFile(filename, func(w io.Writer) error {
+		_, err := trie.WriteTo(w)
 		return err
-	}
-	buffer.Write(ts)
-	ioutil.WriteFile(filename, buffer.Bytes(), 0644)
-	return nil
+	}, opts)
 }
 
-func (trie *Trie) ReadFromFile(filename string) error {
-	data, err := ioutil.ReadFile(filename)
+func (trie *TrieOf[V]) ReadFromFile(filename string) error {
+	f, err := os.Open(filename)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
-	mn := Stoi(data[:8])
-	if mn != magicNumber {
-		return errors.New("invalid data file")
-	}
-	return trie.Unmarshal(data[8:])
+	_, err = trie.ReadFrom(bufio.NewReader(f))
+	return err
 }
 
 // Clone makes a copy of an existing trie.
 // Items stored in both tries become shared, obviously.
-func (trie *Trie) Clone() *Trie {
-	return &Trie{
+func (trie *TrieOf[V]) Clone() *TrieOf[V] {
+	return &TrieOf[V]{
 		Prefix:   append([]byte{}, trie.Prefix...),
 		Item:     trie.Item,
 		Children: trie.Children.clone(),
+		cfg:      trie.cfg,
+		count:    trie.count,
 	}
 }
 
 // Item returns the item stored in the root of this trie.
-func (trie *Trie) Value() *Item {
+func (trie *TrieOf[V]) Value() *V {
 	return trie.Item
 }
 
 // Insert inserts a new item into the trie using the given prefix. Insert does
 // not replace existing items. It returns false if an item was already in place.
-func (trie *Trie) Insert(key []byte, item *Item) (inserted bool) {
+func (trie *TrieOf[V]) Insert(key []byte, item *V) (inserted bool) {
 	return trie.put(key, item, false)
 }
 
 // Set works much like Insert, but it always sets the item, possibly replacing
 // the item previously inserted.
-func (trie *Trie) Set(key []byte, item *Item) {
+func (trie *TrieOf[V]) Set(key []byte, item *V) {
 	trie.put(key, item, true)
 }
 
@@ -134,7 +156,7 @@ func (trie *Trie) Set(key []byte, item *Item) {
 // into the tree by the user or not. A possible workaround for this is not to use
 // nil interface as a valid value, even using zero value of any type is enough
 // to prevent this bad behaviour.
-func (trie *Trie) Get(key []byte) (item *Item) {
+func (trie *TrieOf[V]) Get(key []byte) (item *V) {
 	_, node, found, leftover := trie.findSubtree(key)
 	if !found || len(leftover) != 0 {
 		return nil
@@ -144,13 +166,13 @@ func (trie *Trie) Get(key []byte) (item *Item) {
 
 // Match returns what Get(prefix) != nil would return. The same warning as for
 // Get applies here as well.
-func (trie *Trie) Match(prefix []byte) (matchedExactly bool) {
+func (trie *TrieOf[V]) Match(prefix []byte) (matchedExactly bool) {
 	return trie.Get(prefix) != nil
 }
 
 // MatchSubtree returns true when there is a subtree representing extensions
 // to key, that is if there are any keys in the tree which have key as prefix.
-func (trie *Trie) MatchSubtree(key []byte) (matched bool) {
+func (trie *TrieOf[V]) MatchSubtree(key []byte) (matched bool) {
 	_, _, matched, _ = trie.findSubtree(key)
 	return
 }
@@ -162,27 +184,22 @@ func (trie *Trie) MatchSubtree(key []byte) (matched bool) {
 // and returns that error, unless it is a special error - SkipSubtree. In that
 // case Visit skips the subtree represented by the current node and continues
 // elsewhere.
-func (trie *Trie) Visit(visitor VisitorFunc) error {
+func (trie *TrieOf[V]) Visit(visitor VisitorFuncOf[V]) error {
 	return trie.Walk(nil, visitor)
 }
 
-func (trie *Trie) Size() int {
-	n := 0
-
-	trie.Walk(nil, func(_ []byte, _ *Item) error {
-		n++
-		return nil
-	})
-
-	return n
+// Size returns the number of items in the trie. Items are counted as they
+// are inserted and deleted, so Size does not visit them.
+func (trie *TrieOf[V]) Size() int {
+	return trie.count
 }
 
-func (trie *Trie) total() int {
+func (trie *TrieOf[V]) total() int {
 	return 1 + trie.Children.total()
 }
 
 // VisitSubtree works much like Visit, but it only visits nodes matching prefix.
-func (trie *Trie) VisitSubtree(prefix []byte, visitor VisitorFunc) error {
+func (trie *TrieOf[V]) VisitSubtree(prefix []byte, visitor VisitorFuncOf[V]) error {
 	// Nil prefix not allowed.
 	if prefix == nil {
 		panic(ErrNilPrefix)
@@ -206,7 +223,7 @@ func (trie *Trie) VisitSubtree(prefix []byte, visitor VisitorFunc) error {
 
 // VisitPrefixes visits only nodes that represent prefixes of key.
 // To say the obvious, returning SkipSubtree from visitor makes no sense here.
-func (trie *Trie) VisitPrefixes(key []byte, visitor VisitorFunc) error {
+func (trie *TrieOf[V]) VisitPrefixes(key []byte, visitor VisitorFuncOf[V]) error {
 	// Nil key not allowed.
 	if key == nil {
 		panic(ErrNilPrefix)
@@ -258,7 +275,7 @@ func (trie *Trie) VisitPrefixes(key []byte, visitor VisitorFunc) error {
 // Delete deletes the item represented by the given prefix.
 //
 // True is returned if the matching node was found and deleted.
-func (trie *Trie) Delete(key []byte) (deleted bool) {
+func (trie *TrieOf[V]) Delete(key []byte) (deleted bool) {
 	// Nil prefix not allowed.
 	if key == nil {
 		panic(ErrNilPrefix)
@@ -269,22 +286,28 @@ func (trie *Trie) Delete(key []byte) (deleted bool) {
 		return false
 	}
 
-	// Find the relevant node.
-	path, found, _ := trie.findSubtreePath(key)
-	if !found {
+	// Find the relevant node. A leftover means key ends within the prefix
+	// of the node, so there is no item stored under key.
+	path, found, leftover := trie.findSubtreePath(key)
+	if !found || len(leftover) != 0 {
 		return false
 	}
 
 	node := path[len(path)-1]
-	var parent *Trie
-	if len(path) != 1 {
-		parent = path[len(path)-2]
-	}
 
 	// If the item is already set to nil, there is nothing to do.
 	if node.Item == nil {
 		return false
 	}
+	for _, node := range path {
+		node.invalidate()
+		node.count--
+	}
+
+	var parent *TrieOf[V]
+	if len(path) != 1 {
+		parent = path[len(path)-2]
+	}
 
 	// Delete the item.
 	node.Item = nil
@@ -331,27 +354,19 @@ func (trie *Trie) Delete(key []byte) (deleted bool) {
 	// i+1 is always a valid index since i is never pointing to the last node.
 	// The loop above skips at least the last node since we are sure that the item
 	// is set to nil and it has no children, othewise we would be compacting instead.
-	node.Children.remove(path[i+1].Prefix[0])
+	node.Children = node.Children.remove(path[i+1].Prefix[0])
 
 Compact:
 	// The node is set to the first non-empty ancestor,
 	// so try to compact since that might be possible now.
-	if compacted := node.compact(); compacted != node {
-		if parent == nil {
-			*node = *compacted
-		} else {
-			parent.Children.replace(node.Prefix[0], compacted)
-			*parent = *parent.compact()
-		}
-	}
-
+	compactPath(node, parent)
 	return true
 }
 
 // DeleteSubtree finds the subtree exactly matching prefix and deletes it.
 //
 // True is returned if the subtree was found and deleted.
-func (trie *Trie) DeleteSubtree(prefix []byte) (deleted bool) {
+func (trie *TrieOf[V]) DeleteSubtree(prefix []byte) (deleted bool) {
 	// Nil prefix not allowed.
 	if prefix == nil {
 		panic(ErrNilPrefix)
@@ -363,52 +378,101 @@ func (trie *Trie) DeleteSubtree(prefix []byte) (deleted bool) {
 	}
 
 	// Locate the relevant subtree.
-	parent, root, found, _ := trie.findSubtree(prefix)
+	path, found, _ := trie.findSubtreePath(prefix)
 	if !found {
 		return false
 	}
+	root := path[len(path)-1]
+	for _, node := range path {
+		node.invalidate()
+		node.count -= root.count
+	}
 
 	// If we are in the root of the trie, reset the trie.
-	if parent == nil {
+	if len(path) == 1 {
 		root.reset()
 		return true
 	}
 
-	// Otherwise remove the root node from its parent.
-	parent.Children.remove(root.Prefix[0])
+	// Otherwise remove the root node from its parent, together with the
+	// ancestors left without an item and children.
+	i := len(path) - 2
+	for ; i > 0; i-- {
+		if current := path[i]; current.Item != nil || current.Children.length() >= 2 {
+			break
+		}
+	}
+	node := path[i]
+	node.Children = node.Children.remove(path[i+1].Prefix[0])
+	if node.Empty() {
+		node.reset()
+		return true
+	}
+
+	var parent *TrieOf[V]
+	if i != 0 {
+		parent = path[i-1]
+	}
+	compactPath(node, parent)
 	return true
 }
 
+// compactPath compacts node, which lost its item or a child, with its
+// remaining child. Its parent, nil for the root, is compacted next since it
+// may now be merged with the node.
+func compactPath[V any](node, parent *TrieOf[V]) {
+	if compacted := node.compact(); compacted != node {
+		if parent == nil {
+			*node = *compacted
+			return
+		}
+		parent.Children.replace(node.Prefix[0], compacted)
+	}
+	if parent != nil {
+		if compacted := parent.compact(); compacted != parent {
+			*parent = *compacted
+		}
+	}
+}
+
 // Internal helper methods -----------------------------------------------------
 
-func (trie *Trie) Empty() bool {
+func (trie *TrieOf[V]) Empty() bool {
 	return trie.Item == nil && trie.Children.length() == 0
 }
 
-func (trie *Trie) reset() {
+func (trie *TrieOf[V]) reset() {
+	trie.invalidate()
+	trie.count = 0
 	trie.Prefix = nil
-	trie.Children = newSparseChildList(defaultMaxPrefixPerNode)
+	trie.Item = nil
+	trie.Children = newSparseChildList[V](trie.maxSparse())
 }
 
-func (trie *Trie) put(key []byte, item *Item, replace bool) (inserted bool) {
+func (trie *TrieOf[V]) put(key []byte, item *V, replace bool) (inserted bool) {
 	// Nil prefix not allowed.
 	if key == nil {
 		panic(ErrNilPrefix)
 	}
 
 	var (
-		common int
-		node   *Trie = trie
-		child  *Trie
+		common  int
+		node    *TrieOf[V] = trie
+		parent  *TrieOf[V]
+		child   *TrieOf[V]
+		split   bool
+		fullKey = key
+		max     = trie.maxPrefix()
 	)
+	node.invalidate()
 
 	if node.Prefix == nil {
-		if len(key) <= defaultMaxPrefixPerNode {
+		if len(key) <= max {
 			node.Prefix = key
 			goto InsertItem
 		}
-		node.Prefix = key[:defaultMaxPrefixPerNode]
-		key = key[defaultMaxPrefixPerNode:]
+		node.Prefix = key[:max]
+		key = key[max:]
 		goto AppendChild
 	}
 
@@ -434,15 +498,18 @@ func (trie *Trie) put(key []byte, item *Item, replace bool) (inserted bool) {
 		if child == nil {
 			goto AppendChild
 		}
-		node = child
+		parent, node = node, child
+		node.invalidate()
 	}
 
 SplitPrefix:
 	// Split the prefix if necessary.
-	child = new(Trie)
+	split = true
+	child = new(TrieOf[V])
 	*child = *node
-	*node = *NewTrie()
+	*node = *node.newNode()
 	node.Prefix = child.Prefix[:common]
+	node.count = child.count
 	child.Prefix = child.Prefix[common:]
 	child = child.compact()
 	node.Children = node.Children.add(child)
@@ -451,15 +518,15 @@ AppendChild:
 	// Keep appending children until whole prefix is inserted.
 	// This loop starts with empty node.prefix that needs to be filled.
 	for len(key) != 0 {
-		child := NewTrie()
-		if len(key) <= defaultMaxPrefixPerNode {
+		child := node.newNode()
+		if len(key) <= max {
 			child.Prefix = key
 			node.Children = node.Children.add(child)
 			node = child
 			goto InsertItem
 		} else {
-			child.Prefix = key[:defaultMaxPrefixPerNode]
-			key = key[defaultMaxPrefixPerNode:]
+			child.Prefix = key[:max]
+			key = key[max:]
 			node.Children = node.Children.add(child)
 			node = child
 		}
@@ -468,13 +535,31 @@ AppendChild:
 InsertItem:
 	// Try to insert the item if possible.
 	if replace || node.Item == nil {
+		delta := 0
+		if item != nil {
+			delta++
+		}
+		if node.Item != nil {
+			delta--
+		}
 		node.Item = item
+		if delta != 0 {
+			trie.addCount(fullKey, delta)
+		}
+
+		// The parent of a split node may fit together with its shorter
+		// prefix now.
+		if split && parent != nil {
+			if compacted := parent.compact(); compacted != parent {
+				*parent = *compacted
+			}
+		}
 		return true
 	}
 	return false
 }
 
-func (trie *Trie) compact() *Trie {
+func (trie *TrieOf[V]) compact() *TrieOf[V] {
 	// Only a node with a single child can be compacted.
 	if trie.Children.length() != 1 {
 		return trie
@@ -490,20 +575,59 @@ func (trie *Trie) compact() *Trie {
 	}
 
 	// Make sure the combined prefixes fit into a single node.
-	if len(trie.Prefix)+len(child.Prefix) > defaultMaxPrefixPerNode {
+	if len(trie.Prefix)+len(child.Prefix) > trie.maxPrefix() {
 		return trie
 	}
 
-	// Concatenate the prefixes, move the items.
-	child.Prefix = append(trie.Prefix, child.Prefix...)
-	if trie.Item != nil {
-		child.Item = trie.Item
+	// Concatenate the prefixes into a new node. The child is left untouched
+	// since other versions of the trie may still share it.
+	prefix := make([]byte, 0, len(trie.Prefix)+len(child.Prefix))
+	prefix = append(append(prefix, trie.Prefix...), child.Prefix...)
+	return &TrieOf[V]{
+		Prefix:   prefix,
+		Item:     child.Item,
+		Children: child.Children,
+		cfg:      trie.cfg,
+		count:    child.count,
+	}
+}
+
+// shallowClone copies the node and its child list, sharing the children.
+func (trie *TrieOf[V]) shallowClone() *TrieOf[V] {
+	return &TrieOf[V]{
+		Prefix:   trie.Prefix,
+		Item:     trie.Item,
+		Children: trie.Children.shallowClone(),
+		cfg:      trie.cfg,
+		hash:     atomic.LoadPointer(&trie.hash),
+		count:    trie.count,
 	}
+}
+
+// copyPath returns a copy of the trie in which every node that put, Delete or
+// DeleteSubtree may modify for key is cloned, while all other nodes are shared
+// with the original.
+func (trie *TrieOf[V]) copyPath(key []byte) *TrieOf[V] {
+	root := trie.shallowClone()
+	node := root
+	for {
+		common := node.longestCommonPrefixLength(key)
+		key = key[common:]
+		if common < len(node.Prefix) || len(key) == 0 {
+			return root
+		}
 
-	return child
+		child := node.Children.next(key[0])
+		if child == nil {
+			return root
+		}
+		child = child.shallowClone()
+		node.Children.replace(key[0], child)
+		node = child
+	}
 }
 
-func (trie *Trie) findSubtree(prefix []byte) (parent *Trie, root *Trie, found bool, leftover []byte) {
+func (trie *TrieOf[V]) findSubtree(prefix []byte) (parent *TrieOf[V], root *TrieOf[V], found bool, leftover []byte) {
 	// Find the subtree matching prefix.
 	root = trie
 	for {
@@ -536,10 +660,10 @@ func (trie *Trie) findSubtree(prefix []byte) (parent *Trie, root *Trie, found bo
 	}
 }
 
-func (trie *Trie) findSubtreePath(prefix []byte) (path []*Trie, found bool, leftover []byte) {
+func (trie *TrieOf[V]) findSubtreePath(prefix []byte) (path []*TrieOf[V], found bool, leftover []byte) {
 	// Find the subtree matching prefix.
 	root := trie
-	var subtreePath []*Trie
+	var subtreePath []*TrieOf[V]
 	for {
 		// Append the current root to the path.
 		subtreePath = append(subtreePath, root)
@@ -573,7 +697,7 @@ func (trie *Trie) findSubtreePath(prefix []byte) (path []*Trie, found bool, left
 	}
 }
 
-func (trie *Trie) Walk(actualRootPrefix []byte, visitor VisitorFunc) error {
+func (trie *TrieOf[V]) Walk(actualRootPrefix []byte, visitor VisitorFuncOf[V]) error {
 	var prefix []byte
 	// Allocate a bit more space for prefix at the beginning.
 	if actualRootPrefix == nil {
@@ -601,19 +725,19 @@ func (trie *Trie) Walk(actualRootPrefix []byte, visitor VisitorFunc) error {
 	return trie.Children.walk(&prefix, visitor)
 }
 
-func (trie *Trie) longestCommonPrefixLength(prefix []byte) (i int) {
+func (trie *TrieOf[V]) longestCommonPrefixLength(prefix []byte) (i int) {
 	for ; i < len(prefix) && i < len(trie.Prefix) && prefix[i] == trie.Prefix[i]; i++ {
 	}
 	return
 }
 
-func (trie *Trie) Dump() string {
+func (trie *TrieOf[V]) Dump() string {
 	writer := &bytes.Buffer{}
 	trie.print(writer, 0)
 	return writer.String()
 }
 
-func (trie *Trie) print(writer io.Writer, indent int) {
+func (trie *TrieOf[V]) print(writer io.Writer, indent int) {
 	fmt.Fprintf(writer, "%s%s %v\n", strings.Repeat(" ", indent), string(trie.Prefix), trie.Item)
 	trie.Children.print(writer, indent+2)
 }
@@ -623,4 +747,5 @@ func (trie *Trie) print(writer io.Writer, indent int) {
 var (
 	ErrSkipSubtree = errors.New("skip this subtree")
 	ErrNilPrefix   = errors.New("nil prefix passed into a method call")
+	ErrNilItem     = errors.New("nil item passed into a method call")
 )
@@ -0,0 +1,212 @@
+package indexer
+
+import "sort"
+
+// IteratorOf is a cursor over the items of a trie in ascending key order. It can
+// be moved in both directions and repositioned with Seek, which makes range
+// scans, pagination and merging several tries possible.
+//
+// A new iterator is not positioned, call First, Last or Seek before using it.
+// Modifying the trie invalidates all of its iterators.
+type IteratorOf[V any] struct {
+	trie  *TrieOf[V]
+	stack []iteratorFrame[V]
+	key   []byte
+}
+
+// Iterator is the Item based instantiation of IteratorOf.
+type Iterator = IteratorOf[Item]
+
+// iteratorFrame is a node on the path to the current item.
+type iteratorFrame[V any] struct {
+	node     *TrieOf[V]
+	children TriesOf[V] // children of node in ascending order
+	index    int        // position of node in the children of its parent
+}
+
+// Iterator returns an unpositioned iterator over the trie.
+func (trie *TrieOf[V]) Iterator() *IteratorOf[V] {
+	return &IteratorOf[V]{trie: trie}
+}
+
+// Valid reports whether the iterator is positioned at an item.
+func (it *IteratorOf[V]) Valid() bool {
+	return len(it.stack) != 0
+}
+
+// Key returns the key of the current item. The returned slice is reused by the
+// iterator, copy it to keep it beyond the next move.
+func (it *IteratorOf[V]) Key() []byte {
+	if !it.Valid() {
+		return nil
+	}
+	return it.key
+}
+
+// Item returns the current item, or nil when the iterator is not valid.
+func (it *IteratorOf[V]) Item() *V {
+	if !it.Valid() {
+		return nil
+	}
+	return it.top().node.Item
+}
+
+// First moves to the smallest key.
+func (it *IteratorOf[V]) First() bool {
+	it.reset()
+	it.push(it.trie, 0)
+	return it.descendFirst()
+}
+
+// Last moves to the greatest key.
+func (it *IteratorOf[V]) Last() bool {
+	it.reset()
+	it.push(it.trie, 0)
+	return it.descendLast()
+}
+
+// Seek moves to the smallest key greater than or equal to key.
+func (it *IteratorOf[V]) Seek(key []byte) bool {
+	it.reset()
+	node, index := it.trie, 0
+	for {
+		it.push(node, index)
+		common := node.longestCommonPrefixLength(key)
+		if common < len(node.Prefix) {
+			if common == len(key) || node.Prefix[common] > key[common] {
+				// The whole subtree sorts after key.
+				return it.descendFirst()
+			}
+			// The whole subtree sorts before key.
+			return it.nextSubtree()
+		}
+
+		key = key[common:]
+		if len(key) == 0 {
+			return it.descendFirst()
+		}
+
+		// The item of this node, if any, is a proper prefix of key and sorts
+		// before it. Continue with the first child not sorting before key.
+		children := it.top().children
+		i := sort.Search(len(children), func(i int) bool {
+			return children[i].Prefix[0] >= key[0]
+		})
+		switch {
+		case i == len(children):
+			return it.nextSubtree()
+		case children[i].Prefix[0] > key[0]:
+			it.push(children[i], i)
+			return it.descendFirst()
+		}
+		node, index = children[i], i
+	}
+}
+
+// Next moves to the next key. It returns false once there are no more keys,
+// leaving the iterator invalid.
+func (it *IteratorOf[V]) Next() bool {
+	if !it.Valid() {
+		return false
+	}
+	if children := it.top().children; len(children) != 0 {
+		it.push(children[0], 0)
+		return it.descendFirst()
+	}
+	return it.nextSubtree()
+}
+
+// Prev moves to the previous key. It returns false once there are no more
+// keys, leaving the iterator invalid.
+func (it *IteratorOf[V]) Prev() bool {
+	if !it.Valid() {
+		return false
+	}
+	for {
+		index := it.pop().index
+		if !it.Valid() {
+			return false
+		}
+		parent := it.top()
+		if index > 0 {
+			it.push(parent.children[index-1], index-1)
+			return it.descendLast()
+		}
+		// The item of a node precedes the items of its children.
+		if parent.node.Item != nil {
+			return true
+		}
+	}
+}
+
+// descendFirst moves from the current node to the first item of its subtree.
+func (it *IteratorOf[V]) descendFirst() bool {
+	for {
+		top := it.top()
+		if top.node.Item != nil {
+			return true
+		}
+		if len(top.children) == 0 {
+			// Only an empty trie has a node with neither item nor children.
+			it.reset()
+			return false
+		}
+		it.push(top.children[0], 0)
+	}
+}
+
+// descendLast moves from the current node to the last item of its subtree.
+func (it *IteratorOf[V]) descendLast() bool {
+	for {
+		top := it.top()
+		if n := len(top.children); n != 0 {
+			it.push(top.children[n-1], n-1)
+			continue
+		}
+		if top.node.Item == nil {
+			it.reset()
+			return false
+		}
+		return true
+	}
+}
+
+// nextSubtree moves to the first item following the subtree of the current
+// node.
+func (it *IteratorOf[V]) nextSubtree() bool {
+	for {
+		index := it.pop().index
+		if !it.Valid() {
+			return false
+		}
+		if children := it.top().children; index+1 < len(children) {
+			it.push(children[index+1], index+1)
+			return it.descendFirst()
+		}
+	}
+}
+
+func (it *IteratorOf[V]) top() *iteratorFrame[V] {
+	return &it.stack[len(it.stack)-1]
+}
+
+func (it *IteratorOf[V]) push(node *TrieOf[V], index int) {
+	it.stack = append(it.stack, iteratorFrame[V]{
+		node:     node,
+		children: node.Children.appendChildren(nil),
+		index:    index,
+	})
+	it.key = append(it.key, node.Prefix...)
+}
+
+func (it *IteratorOf[V]) pop() iteratorFrame[V] {
+	frame := *it.top()
+	it.stack = it.stack[:len(it.stack)-1]
+	it.key = it.key[:len(it.key)-len(frame.node.Prefix)]
+	return frame
+}
+
+func (it *IteratorOf[V]) reset() {
+	it.stack = it.stack[:0]
+	it.key = it.key[:0]
+}
@@ -0,0 +1,93 @@
+package indexer
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func randomTrie(rnd *rand.Rand, n int) (*Trie, [][]byte) {
+	trie := NewTrie()
+	var keys [][]byte
+	for i := 0; i < n; i++ {
+		key := make([]byte, 1+rnd.Intn(40))
+		for j := range key {
+			key[j] = byte(rnd.Intn(4)) * 60
+		}
+		if trie.Insert(key, &Item{Pos: uint64(i)}) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	return trie, keys
+}
+
+func TestIteratorScan(t *testing.T) {
+	trie, keys := randomTrie(rand.New(rand.NewSource(1)), 2000)
+
+	it := trie.Iterator()
+	i := 0
+	for ok := it.First(); ok; ok = it.Next() {
+		if !bytes.Equal(it.Key(), keys[i]) {
+			t.Fatalf("item %d: want %x, got %x", i, keys[i], it.Key())
+		}
+		if it.Item() != trie.Get(keys[i]) {
+			t.Fatalf("item %d: item mismatch", i)
+		}
+		i++
+	}
+	if i != len(keys) || it.Valid() {
+		t.Fatalf("forward scan stopped at %d of %d", i, len(keys))
+	}
+
+	for ok := it.Last(); ok; ok = it.Prev() {
+		i--
+		if !bytes.Equal(it.Key(), keys[i]) {
+			t.Fatalf("item %d: want %x, got %x", i, keys[i], it.Key())
+		}
+	}
+	if i != 0 {
+		t.Fatalf("backward scan stopped at %d", i)
+	}
+}
+
+func TestIteratorSeek(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	trie, keys := randomTrie(rnd, 1000)
+
+	it := trie.Iterator()
+	for n := 0; n < 2000; n++ {
+		target := make([]byte, rnd.Intn(42))
+		for j := range target {
+			target[j] = byte(rnd.Intn(5)) * 55
+		}
+		i := sort.Search(len(keys), func(i int) bool { return bytes.Compare(keys[i], target) >= 0 })
+
+		if ok := it.Seek(target); ok != (i < len(keys)) {
+			t.Fatalf("Seek(%x) returned %v", target, ok)
+		}
+		if i == len(keys) {
+			continue
+		}
+		if !bytes.Equal(it.Key(), keys[i]) {
+			t.Fatalf("Seek(%x): want %x, got %x", target, keys[i], it.Key())
+		}
+		if ok := it.Prev(); ok != (i > 0) {
+			t.Fatalf("Prev after Seek(%x) returned %v", target, ok)
+		}
+		if i > 0 && !bytes.Equal(it.Key(), keys[i-1]) {
+			t.Fatalf("Prev after Seek(%x): want %x, got %x", target, keys[i-1], it.Key())
+		}
+	}
+}
+
+func TestIteratorEmptyTrie(t *testing.T) {
+	it := NewTrie().Iterator()
+	if it.First() || it.Last() || it.Seek([]byte("key")) || it.Valid() {
+		t.Fatal("empty trie iterator must not be valid")
+	}
+	if it.Next() || it.Prev() || it.Key() != nil || it.Item() != nil {
+		t.Fatal("invalid iterator must stay invalid")
+	}
+}
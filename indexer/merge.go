@@ -0,0 +1,141 @@
+package indexer
+
+// ResolveFuncOf decides which item to keep when both tries passed to Merge
+// hold an item under key. a belongs to the trie being merged into, b to the
+// other one. Returning nil removes key from the result.
+type ResolveFuncOf[V any] func(key []byte, a, b *V) *V
+
+// ResolveFunc is the Item based instantiation of ResolveFuncOf.
+type ResolveFunc = ResolveFuncOf[Item]
+
+// Merge moves the items of other into the trie. Keys present in both are
+// passed to resolve, a nil resolve keeps the items of the trie like Insert.
+//
+// Both tries are merged subtree by subtree: subtrees of other that do not
+// overlap with the trie are attached as they are instead of being inserted
+// key by key. That requires both tries to be created with the same
+// WithMaxPrefixPerNode and WithMaxChildrenPerSparseNode options, otherwise
+// the nodes of other do not fit the trie and its items are inserted one by
+// one. other must not be used afterwards.
+func (trie *TrieOf[V]) Merge(other *TrieOf[V], resolve ResolveFuncOf[V]) {
+	if other.Empty() {
+		return
+	}
+	if !trie.sameShape(other) {
+		trie.mergeItems(other, resolve)
+		return
+	}
+	if trie.Empty() {
+		other.adopt(trie.cfg)
+		*trie = *other
+		return
+	}
+
+	var removed [][]byte
+	trie.merge(other, nil, resolve, &removed)
+	for _, key := range removed {
+		trie.Delete(key)
+	}
+}
+
+// sameShape reports whether the nodes of other fit the limits of the trie.
+func (trie *TrieOf[V]) sameShape(other *TrieOf[V]) bool {
+	return trie.maxPrefix() == other.maxPrefix() && trie.maxSparse() == other.maxSparse()
+}
+
+// mergeItems merges other into the trie key by key.
+func (trie *TrieOf[V]) mergeItems(other *TrieOf[V], resolve ResolveFuncOf[V]) {
+	other.Walk(nil, func(key []byte, item *V) error {
+		// The key buffer is reused by Walk.
+		key = append([]byte{}, key...)
+		existing := trie.Get(key)
+		switch {
+		case existing == nil:
+			trie.Insert(key, item)
+		case resolve != nil:
+			if item := resolve(key, existing, item); item != nil {
+				trie.Set(key, item)
+			} else {
+				trie.Delete(key)
+			}
+		}
+		return nil
+	})
+}
+
+// merge merges other, whose prefix starts at the same key as the prefix of
+// the node, into the node. Keys for which resolve returned nil are appended
+// to removed.
+func (trie *TrieOf[V]) merge(other *TrieOf[V], key []byte, resolve ResolveFuncOf[V], removed *[][]byte) {
+	trie.invalidate()
+
+	// Split the node where the prefixes part.
+	common := trie.longestCommonPrefixLength(other.Prefix)
+	if common < len(trie.Prefix) {
+		child := new(TrieOf[V])
+		*child = *trie
+		*trie = *trie.newNode()
+		trie.Prefix = child.Prefix[:common]
+		child.Prefix = child.Prefix[common:]
+		trie.Children = trie.Children.add(child.compact())
+	}
+	key = append(key, trie.Prefix...)
+
+	if common < len(other.Prefix) {
+		// The other node continues below this one.
+		other.Prefix = other.Prefix[common:]
+		trie.mergeChild(other, key, resolve, removed)
+	} else {
+		switch {
+		case other.Item == nil:
+		case trie.Item == nil:
+			trie.Item = other.Item
+		case resolve != nil:
+			if item := resolve(key, trie.Item, other.Item); item != nil {
+				trie.Item = item
+			} else {
+				*removed = append(*removed, append([]byte{}, key...))
+			}
+		}
+		for _, child := range other.Children.appendChildren(nil) {
+			trie.mergeChild(child, key, resolve, removed)
+		}
+	}
+
+	trie.count = 0
+	if trie.Item != nil {
+		trie.count++
+	}
+	for _, child := range trie.Children.appendChildren(nil) {
+		trie.count += child.count
+	}
+
+	if compacted := trie.compact(); compacted != trie {
+		*trie = *compacted
+	}
+}
+
+// mergeChild merges child of another trie into the children of the node.
+func (trie *TrieOf[V]) mergeChild(child *TrieOf[V], key []byte, resolve ResolveFuncOf[V], removed *[][]byte) {
+	existing := trie.Children.next(child.Prefix[0])
+	if existing == nil {
+		child.adopt(trie.cfg)
+		trie.Children = trie.Children.add(child)
+		return
+	}
+	existing.merge(child, key, resolve, removed)
+}
+
+// adopt makes the nodes of the trie use the settings of another trie.
+func (trie *TrieOf[V]) adopt(cfg *config[V]) {
+	if trie.cfg == cfg {
+		return
+	}
+	stack := TriesOf[V]{trie}
+	for len(stack) != 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		node.cfg = cfg
+		stack = node.Children.appendChildren(stack)
+	}
+}
@@ -0,0 +1,123 @@
+package indexer
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	rnd := rand.New(rand.NewSource(11))
+	for i := 0; i < 20; i++ {
+		a, aKeys := randomTrie(rnd, rnd.Intn(500))
+		b, bKeys := randomTrie(rnd, rnd.Intn(500))
+
+		want := make(map[string]Item)
+		for _, key := range aKeys {
+			want[string(key)] = *a.Get(key)
+		}
+		conflicts := 0
+		for _, key := range bKeys {
+			item := *b.Get(key)
+			if old, ok := want[string(key)]; ok {
+				conflicts++
+				if item.Pos%2 == 0 {
+					delete(want, string(key))
+					continue
+				}
+				item.Length = old.Pos
+			}
+			want[string(key)] = item
+		}
+
+		resolved := 0
+		a.Merge(b, func(key []byte, x, y *Item) *Item {
+			resolved++
+			if y.Pos%2 == 0 {
+				return nil
+			}
+			return &Item{Pos: y.Pos, Length: x.Pos}
+		})
+		if resolved != conflicts {
+			t.Fatalf("want %d conflicts, got %d", conflicts, resolved)
+		}
+
+		expected := NewTrie()
+		for key, item := range want {
+			item := item
+			expected.Insert([]byte(key), &item)
+		}
+		assertSameItems(t, expected, a)
+		if !bytes.Equal(mustRoot(t, expected), mustRoot(t, a)) {
+			t.Fatal("merged trie has a different root")
+		}
+	}
+}
+
+func TestMergeKeepsExistingItems(t *testing.T) {
+	a := NewTrie()
+	a.Insert([]byte("abc"), &Item{Pos: 1})
+	b := NewTrie()
+	b.Insert([]byte("abc"), &Item{Pos: 2})
+	b.Insert([]byte("abd"), &Item{Pos: 3})
+
+	a.Merge(b, nil)
+	if a.Get([]byte("abc")).Pos != 1 || a.Get([]byte("abd")).Pos != 3 {
+		t.Fatalf("unexpected items\n%s", a.Dump())
+	}
+}
+
+func TestMergeReusesDisjointSubtrees(t *testing.T) {
+	a := NewTrie()
+	a.Insert([]byte("apple"), &Item{Pos: 1})
+	a.Insert([]byte("apricot"), &Item{Pos: 2})
+	b := NewTrie()
+	b.Insert([]byte("banana"), &Item{Pos: 3})
+	b.Insert([]byte("blueberry"), &Item{Pos: 4})
+	subtree := b
+
+	a.Merge(b, nil)
+	if a.Children.next('b') != subtree {
+		t.Fatalf("subtree was not reused\n%s", a.Dump())
+	}
+	if a.Size() != 4 {
+		t.Fatalf("want 4 items, got %d", a.Size())
+	}
+}
+
+func TestMergeDifferentShape(t *testing.T) {
+	rnd := rand.New(rand.NewSource(13))
+	long := func(n int) (*Trie, [][]byte) {
+		trie := NewTrie(WithMaxPrefixPerNode(64), WithMaxChildrenPerSparseNode(4))
+		var keys [][]byte
+		for i := 0; i < n; i++ {
+			key := make([]byte, 60)
+			rnd.Read(key[50:])
+			trie.Insert(key, &Item{Pos: uint64(i)})
+			keys = append(keys, key)
+		}
+		return trie, keys
+	}
+
+	for _, size := range []int{0, 100} {
+		a, aKeys := randomTrie(rnd, size)
+		b, bKeys := long(200)
+		// A key of b is already in a.
+		a.Insert(bKeys[0], &Item{Pos: 1000})
+		aKeys = append(aKeys, bKeys[0])
+
+		a.Merge(b, func(key []byte, x, y *Item) *Item { return y })
+		if err := a.Validate(); err != nil {
+			t.Fatalf("merge into %d items: %v", size, err)
+		}
+		assertShape(t, a, defaultMaxPrefixPerNode, defaultMaxChildrenPerSparseNode)
+		if a.Size() != len(aKeys)+len(bKeys)-1 {
+			t.Fatalf("merge into %d items: %d items", size, a.Size())
+		}
+		for i, key := range bKeys {
+			if item := a.Get(key); item == nil || item.Pos != uint64(i) {
+				t.Fatalf("merge into %d items: %x holds %v", size, key, item)
+			}
+		}
+	}
+}
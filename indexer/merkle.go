@@ -0,0 +1,129 @@
+package indexer
+
+import (
+	"crypto/sha256"
+	"hash"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Merkle hashing
+//
+// The root hash commits to the set of keys and the encoding of their values,
+// not to the way the trie happens to be split into nodes. Nodes without an
+// item and with a single child only split long prefixes into chunks, so they
+// are skipped and their prefixes joined into the label of the edge leading
+// to the next real node. The hash of a real node is
+//
+//	sha256(0x00 | 0x00)                                         without item
+//	sha256(0x00 | 0x01 | uvarint(len(value)) | value)           with item
+//
+// followed, inside the same hash, by uvarint(len(label)) | label | hash of
+// the child for every child in ascending order. The root hash is
+//
+//	sha256(0x01 | uvarint(len(label)) | label | hash of the root node)
+//
+// where label is the prefix leading from the empty key to the first real node.
+const (
+	nodeHashTag = 0x00
+	rootHashTag = 0x01
+)
+
+// Root returns the Merkle root of the trie. The hashes of all nodes are
+// cached, so after a modification only the nodes on the path to the modified
+// key are hashed again. Items must not be modified in place, use Set instead.
+//
+// Two tries holding the same keys and values have the same root.
+func (trie *TrieOf[V]) Root() ([]byte, error) {
+	codec, err := trie.codec()
+	if err != nil {
+		return nil, err
+	}
+	label, node := trie.label(nil)
+	return rootHash(label, node.nodeHash(codec)[:]), nil
+}
+
+// label appends the prefixes of the chain of single-child nodes starting at
+// the trie to dst. It returns them together with the real node ending the
+// chain.
+func (trie *TrieOf[V]) label(dst []byte) ([]byte, *TrieOf[V]) {
+	node := trie
+	dst = append(dst, node.Prefix...)
+	for node.Item == nil && node.Children.length() == 1 {
+		node = node.Children.head()
+		dst = append(dst, node.Prefix...)
+	}
+	return dst, node
+}
+
+// nodeHash returns the hash of a real node, computing it when it is not
+// cached yet.
+func (trie *TrieOf[V]) nodeHash(codec ValueCodec[V]) *[sha256.Size]byte {
+	if sum := trie.cachedHash(); sum != nil {
+		return sum
+	}
+
+	var value []byte
+	if trie.Item != nil {
+		value = codec.AppendValue(nil, trie.Item)
+	}
+	h := newNodeHash(value, trie.Item != nil)
+
+	var label []byte
+	for _, child := range trie.Children.appendChildren(nil) {
+		var node *TrieOf[V]
+		label, node = child.label(label[:0])
+		writeChild(h, label, node.nodeHash(codec)[:])
+	}
+
+	sum := new([sha256.Size]byte)
+	h.Sum(sum[:0])
+	trie.setHash(sum)
+	return sum
+}
+
+// newNodeHash starts the hash of a node, to be completed by writeChild for
+// each of its children.
+func newNodeHash(value []byte, hasValue bool) hash.Hash {
+	h := sha256.New()
+	buf := []byte{nodeHashTag, 0}
+	if hasValue {
+		buf[1] = 1
+		buf = appendUvarint(buf, uint64(len(value)))
+	}
+	h.Write(buf)
+	h.Write(value)
+	return h
+}
+
+func writeChild(h hash.Hash, label, sum []byte) {
+	h.Write(appendUvarint(nil, uint64(len(label))))
+	h.Write(label)
+	h.Write(sum)
+}
+
+func rootHash(label, sum []byte) []byte {
+	h := sha256.New()
+	buf := appendUvarint([]byte{rootHashTag}, uint64(len(label)))
+	h.Write(buf)
+	h.Write(label)
+	h.Write(sum)
+	return h.Sum(nil)
+}
+
+// The cached hash is accessed atomically, since concurrent readers of a
+// ConcurrentTrie or a PersistentTrie may compute it at the same time.
+
+func (trie *TrieOf[V]) cachedHash() *[sha256.Size]byte {
+	return (*[sha256.Size]byte)(atomic.LoadPointer(&trie.hash))
+}
+
+func (trie *TrieOf[V]) setHash(sum *[sha256.Size]byte) {
+	atomic.StorePointer(&trie.hash, unsafe.Pointer(sum))
+}
+
+// invalidate drops the cached hash of the node, which must be done whenever
+// its item or children change.
+func (trie *TrieOf[V]) invalidate() {
+	atomic.StorePointer(&trie.hash, nil)
+}
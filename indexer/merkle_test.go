@@ -0,0 +1,178 @@
+package indexer
+
+import (
+	"bytes"
+	"hash/crc32"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func mustRoot(t *testing.T, trie *Trie) []byte {
+	t.Helper()
+	root, err := trie.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestRootIgnoresInsertionOrder(t *testing.T) {
+	trie, keys := randomTrie(rand.New(rand.NewSource(3)), 1000)
+
+	shuffled := NewTrie()
+	for _, i := range rand.New(rand.NewSource(4)).Perm(len(keys)) {
+		shuffled.Insert(keys[i], trie.Get(keys[i]))
+	}
+	if !bytes.Equal(mustRoot(t, trie), mustRoot(t, shuffled)) {
+		t.Fatal("same contents produced different roots")
+	}
+
+	// Deleting keys leaves chunk nodes behind which must not matter either.
+	for _, key := range keys[:500] {
+		trie.Delete(key)
+	}
+	rebuilt := NewTrie()
+	for _, key := range keys[500:] {
+		rebuilt.Insert(key, trie.Get(key))
+	}
+	if !bytes.Equal(mustRoot(t, trie), mustRoot(t, rebuilt)) {
+		t.Fatal("same contents produced different roots after deletes")
+	}
+}
+
+func TestRootInvalidation(t *testing.T) {
+	rnd := rand.New(rand.NewSource(5))
+	trie, keys := randomTrie(rnd, 500)
+	empty := mustRoot(t, NewTrie())
+
+	for i := 0; i < 2000; i++ {
+		key := keys[rnd.Intn(len(keys))]
+		switch rnd.Intn(4) {
+		case 0:
+			trie.Set(key, &Item{Pos: uint64(rnd.Intn(4))})
+		case 1:
+			trie.Delete(key)
+		case 2:
+			trie.DeleteSubtree(key[:rnd.Intn(len(key))])
+		default:
+			trie.Insert(key, &Item{Pos: uint64(i)})
+		}
+
+		// A clone has no cached hashes, so it is hashed from scratch.
+		got, want := mustRoot(t, trie), mustRoot(t, trie.Clone())
+		if !bytes.Equal(got, want) {
+			t.Fatalf("step %d: stale cached root", i)
+		}
+		if trie.Empty() != bytes.Equal(got, empty) {
+			t.Fatalf("step %d: root of empty trie mismatch", i)
+		}
+		if trie.Empty() {
+			trie, keys = randomTrie(rnd, 500)
+		}
+	}
+}
+
+func TestRootDependsOnValues(t *testing.T) {
+	trie := newHashTrie(100)
+	root := mustRoot(t, trie)
+
+	var key []byte
+	trie.Walk(nil, func(prefix []byte, _ *Item) error {
+		key = append([]byte{}, prefix...)
+		return ErrSkipSubtree
+	})
+	item := *trie.Get(key)
+	item.Length++
+	trie.Set(key, &item)
+	if bytes.Equal(root, mustRoot(t, trie)) {
+		t.Fatal("changing a value did not change the root")
+	}
+	item.Length--
+	trie.Set(key, &item)
+	if !bytes.Equal(root, mustRoot(t, trie)) {
+		t.Fatal("restoring a value did not restore the root")
+	}
+}
+
+func TestPersistentRoot(t *testing.T) {
+	v1 := Persist(newHashTrie(1000))
+	root1, _ := v1.Root()
+	v2 := v1.Set([]byte("extra"), &Item{Pos: 1})
+	root2, _ := v2.Root()
+	if bytes.Equal(root1, root2) {
+		t.Fatal("new version has the same root")
+	}
+	if again, _ := v1.Root(); !bytes.Equal(root1, again) {
+		t.Fatal("old version root changed")
+	}
+
+	v3, _ := v2.Delete([]byte("extra"))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if root, _ := v3.Root(); !bytes.Equal(root, root1) {
+				t.Error("deleting the extra key did not restore the root")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestIndexRoot(t *testing.T) {
+	trie := newHashTrie(1000)
+	filename := filepath.Join(t.TempDir(), "h1")
+	if err := trie.SaveIndexToFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := OpenIndex(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	root, err := idx.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(root, mustRoot(t, trie)) {
+		t.Fatal("index and trie roots differ")
+	}
+	// The root is read from the file rather than computed.
+	if allocs := testing.AllocsPerRun(10, func() { idx.Root() }); allocs > 1 {
+		t.Fatalf("Root allocates %.0f times", allocs)
+	}
+
+	// Index files written before the root was stored compute it.
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data[:headerSize:headerSize], data[headerSize+rootSize:len(data)-checksumSize]...)
+	data[13] &^= flagRoot
+	data = appendUint32(data, crc32.Checksum(data, crcTable))
+	old := filepath.Join(t.TempDir(), "h0")
+	if err := os.WriteFile(old, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldIdx, err := OpenIndex(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oldIdx.Close()
+	if err := oldIdx.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if root, err := oldIdx.Root(); err != nil || !bytes.Equal(root, mustRoot(t, trie)) {
+			t.Fatalf("root of an index without stored root: %v", err)
+		}
+	}
+	if got := oldIdx.Get(sortedKeys(trie)[10]); got == nil {
+		t.Fatal("records of an index without stored root not found")
+	}
+}
@@ -0,0 +1,58 @@
+package indexer
+
+import "bytes"
+
+// Floor returns the greatest key less than or equal to key together with its
+// item, or nil when every key is greater.
+func (trie *TrieOf[V]) Floor(key []byte) ([]byte, *V) {
+	i := trie.Rank(key)
+	if found, item := trie.Select(i); item != nil && bytes.Equal(found, key) {
+		return found, item
+	}
+	return trie.Select(i - 1)
+}
+
+// Ceil returns the smallest key greater than or equal to key together with
+// its item, or nil when every key is smaller.
+func (trie *TrieOf[V]) Ceil(key []byte) ([]byte, *V) {
+	return trie.Select(trie.Rank(key))
+}
+
+// LongestPrefix returns the longest key that is a prefix of key, key itself
+// included, together with its item. It returns nil when there is none.
+func (trie *TrieOf[V]) LongestPrefix(key []byte) ([]byte, *V) {
+	// Nil key not allowed.
+	if key == nil {
+		panic(ErrNilPrefix)
+	}
+
+	var (
+		match  *V
+		length int
+		offset int
+		node   = trie
+		rest   = key
+	)
+	for {
+		common := node.longestCommonPrefixLength(rest)
+		if common < len(node.Prefix) {
+			break
+		}
+		rest = rest[common:]
+		offset += common
+		if node.Item != nil {
+			match, length = node.Item, offset
+		}
+		if len(rest) == 0 {
+			break
+		}
+		if node = node.Children.next(rest[0]); node == nil {
+			break
+		}
+	}
+
+	if match == nil {
+		return nil, nil
+	}
+	return append([]byte{}, key[:length]...), match
+}
@@ -0,0 +1,99 @@
+package indexer
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestFloorCeil(t *testing.T) {
+	rnd := rand.New(rand.NewSource(20))
+	trie, keys := randomTrie(rnd, 500)
+
+	probes := append([][]byte{{}, {0}, {255, 255}}, keys...)
+	for i := 0; i < 500; i++ {
+		probe := make([]byte, rnd.Intn(8))
+		for j := range probe {
+			probe[j] = byte(rnd.Intn(5)) * 50
+		}
+		probes = append(probes, probe)
+	}
+
+	for _, probe := range probes {
+		i := sort.Search(len(keys), func(i int) bool { return bytes.Compare(keys[i], probe) >= 0 })
+
+		key, item := trie.Ceil(probe)
+		if i == len(keys) {
+			if key != nil || item != nil {
+				t.Fatalf("ceil %x: want none, got %x", probe, key)
+			}
+		} else if !bytes.Equal(key, keys[i]) || item != trie.Get(keys[i]) {
+			t.Fatalf("ceil %x: want %x, got %x", probe, keys[i], key)
+		}
+
+		if i == len(keys) || !bytes.Equal(keys[i], probe) {
+			i--
+		}
+		key, item = trie.Floor(probe)
+		if i < 0 {
+			if key != nil || item != nil {
+				t.Fatalf("floor %x: want none, got %x", probe, key)
+			}
+		} else if !bytes.Equal(key, keys[i]) || item != trie.Get(keys[i]) {
+			t.Fatalf("floor %x: want %x, got %x", probe, keys[i], key)
+		}
+	}
+
+	if key, item := NewTrie().Floor([]byte{1}); key != nil || item != nil {
+		t.Fatal("floor in an empty trie")
+	}
+
+	// The empty key is found like any other.
+	empty := &Item{Pos: 1}
+	trie = NewTrie()
+	trie.Insert([]byte{}, empty)
+	trie.Insert([]byte("b"), &Item{Pos: 2})
+	for _, probe := range [][]byte{{}, []byte("a")} {
+		if key, item := trie.Floor(probe); key == nil || len(key) != 0 || item != empty {
+			t.Fatalf("floor %x: want the empty key, got %x", probe, key)
+		}
+	}
+	if key, item := trie.Ceil([]byte{}); key == nil || len(key) != 0 || item != empty {
+		t.Fatalf("ceil of the empty key: got %x", key)
+	}
+}
+
+func TestLongestPrefix(t *testing.T) {
+	trie := NewTrie()
+	for i, key := range []string{"", "a", "abc", "abcdef", "b"} {
+		trie.Insert([]byte(key), &Item{Pos: uint64(i)})
+	}
+
+	cases := map[string]string{
+		"":        "",
+		"a":       "a",
+		"ab":      "a",
+		"abc":     "abc",
+		"abcde":   "abc",
+		"abcdefg": "abcdef",
+		"bcd":     "b",
+		"c":       "",
+	}
+	for probe, want := range cases {
+		key, item := trie.LongestPrefix([]byte(probe))
+		if item == nil || string(key) != want || item != trie.Get([]byte(want)) {
+			t.Fatalf("%q: want %q, got %q", probe, want, key)
+		}
+	}
+
+	trie.Delete([]byte(""))
+	if key, item := trie.LongestPrefix([]byte("c")); key != nil || item != nil {
+		t.Fatalf("want no match, got %q", key)
+	}
+
+	pt := Persist(trie)
+	if key, _ := pt.LongestPrefix([]byte("abcd")); string(key) != "abc" {
+		t.Fatalf("persistent trie: got %q", key)
+	}
+}
@@ -0,0 +1,142 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/valyala/gozstd"
+)
+
+const (
+	defaultMaxPrefixPerNode         = 32
+	defaultMaxChildrenPerSparseNode = 16
+	defaultCompressionLevel         = gozstd.DefaultCompressionLevel
+
+	maxCompressionLevel = 22
+)
+
+// Option configures a trie created by NewTrie, NewTrieOf or a builder.
+type Option func(*settings)
+
+// settings are the tunables of a trie. Apart from the value codec they are
+// stored in the header written by WriteTo, see format.go.
+type settings struct {
+	maxPrefixPerNode         int
+	maxChildrenPerSparseNode int
+	compressionLevel         int
+
+	// valueCodec is the ValueCodec set by WithValueCodec, checked against
+	// the value type by NewTrieOf.
+	valueCodec any
+}
+
+// config holds the settings shared by all nodes of a trie.
+type config[V any] struct {
+	settings
+	codec ValueCodec[V]
+}
+
+func defaultSettings() settings {
+	return settings{
+		maxPrefixPerNode:         defaultMaxPrefixPerNode,
+		maxChildrenPerSparseNode: defaultMaxChildrenPerSparseNode,
+		compressionLevel:         defaultCompressionLevel,
+	}
+}
+
+// newConfig applies opts over the defaults. It panics when an option is
+// invalid, the same way Insert panics on a nil key.
+func newConfig[V any](codec ValueCodec[V], opts []Option) *config[V] {
+	cfg := &config[V]{settings: defaultSettings(), codec: codec}
+	for _, opt := range opts {
+		opt(&cfg.settings)
+	}
+	if err := cfg.validate(); err != nil {
+		panic(err)
+	}
+	if cfg.valueCodec != nil {
+		codec, ok := cfg.valueCodec.(ValueCodec[V])
+		if !ok {
+			panic(fmt.Errorf("%w: %T does not encode the values of the trie", ErrInvalidOption, cfg.valueCodec))
+		}
+		cfg.codec = codec
+		cfg.valueCodec = nil
+	}
+	return cfg
+}
+
+// withSettings returns a copy of the config using s, keeping the codec.
+func (cfg *config[V]) withSettings(s settings) *config[V] {
+	return &config[V]{settings: s, codec: cfg.codec}
+}
+
+// WithMaxPrefixPerNode sets the longest prefix a single node stores, longer
+// keys are split into chains of nodes. It must be between 1 and 65535.
+func WithMaxPrefixPerNode(n int) Option {
+	return func(s *settings) {
+		s.maxPrefixPerNode = n
+	}
+}
+
+// WithMaxChildrenPerSparseNode sets how many children a node keeps in a
+// sorted slice before switching to an indexed or dense child list. It must be
+// between 1 and 256.
+func WithMaxChildrenPerSparseNode(n int) Option {
+	return func(s *settings) {
+		s.maxChildrenPerSparseNode = n
+	}
+}
+
+// WithCompressionLevel sets the zstd level used by WriteTo, from 1 to 22.
+// Level 0 writes the payload uncompressed.
+func WithCompressionLevel(level int) Option {
+	return func(s *settings) {
+		s.compressionLevel = level
+	}
+}
+
+// WithValueCodec replaces the value codec of the trie. The codec must encode
+// the value type of the trie it is applied to.
+func WithValueCodec[V any](codec ValueCodec[V]) Option {
+	return func(s *settings) {
+		s.valueCodec = codec
+	}
+}
+
+func (s *settings) validate() error {
+	switch {
+	case s.maxPrefixPerNode < 1 || s.maxPrefixPerNode > 0xffff:
+		return fmt.Errorf("%w: max prefix per node %d", ErrInvalidOption, s.maxPrefixPerNode)
+	case s.maxChildrenPerSparseNode < 1 || s.maxChildrenPerSparseNode > 256:
+		return fmt.Errorf("%w: max children per sparse node %d", ErrInvalidOption, s.maxChildrenPerSparseNode)
+	case s.compressionLevel < 0 || s.compressionLevel > maxCompressionLevel:
+		return fmt.Errorf("%w: compression level %d", ErrInvalidOption, s.compressionLevel)
+	}
+	return nil
+}
+
+// isDefault reports whether the settings can be left out of the header.
+func (s *settings) isDefault() bool {
+	d := defaultSettings()
+	return s.maxPrefixPerNode == d.maxPrefixPerNode &&
+		s.maxChildrenPerSparseNode == d.maxChildrenPerSparseNode &&
+		s.compressionLevel == d.compressionLevel
+}
+
+// maxPrefix returns the longest prefix a node of the trie may store.
+func (trie *TrieOf[V]) maxPrefix() int {
+	if trie.cfg == nil {
+		return defaultMaxPrefixPerNode
+	}
+	return trie.cfg.maxPrefixPerNode
+}
+
+// maxSparse returns the number of children kept in a sparse child list.
+func (trie *TrieOf[V]) maxSparse() int {
+	if trie.cfg == nil {
+		return defaultMaxChildrenPerSparseNode
+	}
+	return trie.cfg.maxChildrenPerSparseNode
+}
+
+var ErrInvalidOption = errors.New("invalid trie option")
@@ -0,0 +1,171 @@
+package indexer
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/valyala/gozstd"
+)
+
+// assertShape checks that no node of the trie exceeds the given limits.
+func assertShape(t *testing.T, trie *Trie, maxPrefix, maxSparse int) {
+	t.Helper()
+	stack := Tries{trie}
+	for len(stack) != 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if len(node.Prefix) > maxPrefix {
+			t.Fatalf("prefix %x longer than %d", node.Prefix, maxPrefix)
+		}
+		if list, ok := node.Children.(*SparseChildList); ok && list.max != maxSparse {
+			t.Fatalf("sparse list limited to %d children, want %d", list.max, maxSparse)
+		}
+		if _, ok := node.Children.(*SparseChildList); !ok && node.Children.length() <= maxSparse {
+			t.Fatalf("%d children kept in %s", node.Children.length(), childKind(node.Children))
+		}
+		stack = node.Children.appendChildren(stack)
+	}
+}
+
+func TestOptionsShapeTrie(t *testing.T) {
+	opts := []Option{WithMaxPrefixPerNode(3), WithMaxChildrenPerSparseNode(2)}
+	trie := NewTrie(opts...)
+	reference := newHashTrie(200)
+	reference.Walk(nil, func(key []byte, item *Item) error {
+		trie.Insert(append([]byte{}, key...), item)
+		return nil
+	})
+	assertShape(t, trie, 3, 2)
+	assertSameItems(t, reference, trie)
+	if !bytes.Equal(mustRoot(t, trie), mustRoot(t, reference)) {
+		t.Fatal("options changed the root hash")
+	}
+
+	builder := NewBuilder(opts...)
+	for _, key := range sortedKeys(reference) {
+		if err := builder.Add(key, reference.Get(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertShape(t, builder.Trie(), 3, 2)
+}
+
+func TestOptionsPersisted(t *testing.T) {
+	reference := newHashTrie(300)
+	for _, level := range []int{0, 1, 19} {
+		trie := NewTrie(WithMaxPrefixPerNode(5), WithMaxChildrenPerSparseNode(40), WithCompressionLevel(level))
+		reference.Walk(nil, func(key []byte, item *Item) error {
+			trie.Insert(append([]byte{}, key...), item)
+			return nil
+		})
+		data, err := trie.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data[13]&flagOptions == 0 {
+			t.Fatalf("level %d: options not stored", level)
+		}
+		if codec := data[12]; (codec == codecNone) != (level == 0) {
+			t.Fatalf("level %d: payload codec %d", level, codec)
+		}
+
+		loaded := NewTrie()
+		if err := loaded.Unmarshal(data); err != nil {
+			t.Fatal(err)
+		}
+		assertShape(t, loaded, 5, 40)
+		assertSameItems(t, reference, loaded)
+		if loaded.cfg.compressionLevel != level {
+			t.Fatalf("want compression level %d, got %d", level, loaded.cfg.compressionLevel)
+		}
+
+		// A trie holding items keeps its own options.
+		existing := NewTrie()
+		existing.Insert([]byte("x"), &Item{})
+		if err := existing.Unmarshal(data); err != nil {
+			t.Fatal(err)
+		}
+		assertShape(t, existing, defaultMaxPrefixPerNode, defaultMaxChildrenPerSparseNode)
+	}
+}
+
+func TestDefaultOptionsLoaded(t *testing.T) {
+	reference := newHashTrie(300)
+	data, err := reference.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records bytes.Buffer
+	reference.Walk(nil, func(key []byte, item *Item) error {
+		records.Write(key)
+		records.Write(Itos(item.Pos))
+		records.Write(Itos(item.Length))
+		return nil
+	})
+	legacy := append(Itos(magicNumber), gozstd.Compress(nil, records.Bytes())...)
+
+	// Files without stored options were written with the defaults, an empty
+	// trie takes them over.
+	for name, data := range map[string][]byte{"current": data, "legacy": legacy, "headerless": legacy[8:]} {
+		loaded := NewTrie(WithMaxPrefixPerNode(4), WithMaxChildrenPerSparseNode(2))
+		if err := loaded.Unmarshal(data); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		assertShape(t, loaded, defaultMaxPrefixPerNode, defaultMaxChildrenPerSparseNode)
+		assertSameItems(t, reference, loaded)
+		if loaded.cfg.settings != defaultSettings() {
+			t.Fatalf("%s: loaded with %+v", name, loaded.cfg.settings)
+		}
+	}
+}
+
+func TestDefaultOptionsNotStored(t *testing.T) {
+	data, err := newHashTrie(10).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[13]&flagOptions != 0 {
+		t.Fatal("default options stored")
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	cases := map[string]Option{
+		"prefix":      WithMaxPrefixPerNode(0),
+		"long prefix": WithMaxPrefixPerNode(1 << 16),
+		"sparse":      WithMaxChildrenPerSparseNode(257),
+		"level":       WithCompressionLevel(23),
+		"codec":       WithValueCodec[string](stringCodec{}),
+	}
+	for name, opt := range cases {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				err, _ := recover().(error)
+				if !errors.Is(err, ErrInvalidOption) {
+					t.Fatalf("want %v, got %v", ErrInvalidOption, err)
+				}
+			}()
+			NewTrie(opt)
+		})
+	}
+
+	data, err := NewTrie(WithMaxPrefixPerNode(8)).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[headerSize+1] = 0
+	data[headerSize] = 0
+	if err := NewTrie().Unmarshal(data); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("want %v, got %v", ErrCorrupted, err)
+	}
+}
+
+func TestWithValueCodec(t *testing.T) {
+	trie := NewTrieOf[string](nil, WithValueCodec[string](stringCodec{}))
+	value := "value"
+	trie.Insert([]byte("key"), &value)
+	if _, err := trie.Marshal(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,198 @@
+package indexer
+
+import (
+	"context"
+	"io"
+)
+
+// PersistentTrieOf is an immutable version of a trie. Insert, Set, Delete and
+// DeleteSubtree leave the receiver untouched and return a new version which
+// shares every node off the modified path with it, so keeping a version per
+// block costs only the copied paths.
+//
+// A version never changes once created and is safe for concurrent reads.
+type PersistentTrieOf[V any] struct {
+	root *TrieOf[V]
+}
+
+// PersistentTrie is the Item based instantiation of PersistentTrieOf.
+type PersistentTrie = PersistentTrieOf[Item]
+
+// NewPersistentTrie returns an empty PersistentTrie.
+func NewPersistentTrie() *PersistentTrie {
+	return &PersistentTrie{root: NewTrie()}
+}
+
+// Persist makes trie the first version of a PersistentTrieOf. The trie must
+// not be modified afterwards, use Thaw to get a mutable copy back.
+func Persist[V any](trie *TrieOf[V]) *PersistentTrieOf[V] {
+	return &PersistentTrieOf[V]{root: trie}
+}
+
+// Thaw returns a mutable deep copy of this version.
+func (pt *PersistentTrieOf[V]) Thaw() *TrieOf[V] {
+	return pt.root.Clone()
+}
+
+// Insert returns a version with item inserted under key. Like Trie.Insert it
+// does not replace existing items, in which case the receiver is returned
+// together with false.
+func (pt *PersistentTrieOf[V]) Insert(key []byte, item *V) (*PersistentTrieOf[V], bool) {
+	if key == nil {
+		panic(ErrNilPrefix)
+	}
+	if pt.root.Get(key) != nil {
+		return pt, false
+	}
+	root := pt.root.copyPath(key)
+	root.put(key, item, false)
+	return &PersistentTrieOf[V]{root: root}, true
+}
+
+// Set returns a version with item stored under key.
+func (pt *PersistentTrieOf[V]) Set(key []byte, item *V) *PersistentTrieOf[V] {
+	if key == nil {
+		panic(ErrNilPrefix)
+	}
+	root := pt.root.copyPath(key)
+	root.put(key, item, true)
+	return &PersistentTrieOf[V]{root: root}
+}
+
+// Delete returns a version without the item stored under key. When there is
+// no such item the receiver is returned together with false.
+func (pt *PersistentTrieOf[V]) Delete(key []byte) (*PersistentTrieOf[V], bool) {
+	if key == nil {
+		panic(ErrNilPrefix)
+	}
+	if pt.root.Get(key) == nil {
+		return pt, false
+	}
+	root := pt.root.copyPath(key)
+	root.Delete(key)
+	return &PersistentTrieOf[V]{root: root}, true
+}
+
+// DeleteSubtree returns a version without the subtree matching prefix. When
+// there is no such subtree the receiver is returned together with false.
+func (pt *PersistentTrieOf[V]) DeleteSubtree(prefix []byte) (*PersistentTrieOf[V], bool) {
+	if prefix == nil {
+		panic(ErrNilPrefix)
+	}
+	if pt.root.Prefix == nil || !pt.root.MatchSubtree(prefix) {
+		return pt, false
+	}
+	root := pt.root.copyPath(prefix)
+	root.DeleteSubtree(prefix)
+	return &PersistentTrieOf[V]{root: root}, true
+}
+
+func (pt *PersistentTrieOf[V]) Get(key []byte) *V {
+	return pt.root.Get(key)
+}
+
+func (pt *PersistentTrieOf[V]) Match(prefix []byte) (matchedExactly bool) {
+	return pt.root.Match(prefix)
+}
+
+func (pt *PersistentTrieOf[V]) MatchSubtree(key []byte) (matched bool) {
+	return pt.root.MatchSubtree(key)
+}
+
+func (pt *PersistentTrieOf[V]) Walk(actualRootPrefix []byte, visitor VisitorFuncOf[V]) error {
+	return pt.root.Walk(actualRootPrefix, visitor)
+}
+
+func (pt *PersistentTrieOf[V]) Visit(visitor VisitorFuncOf[V]) error {
+	return pt.root.Visit(visitor)
+}
+
+func (pt *PersistentTrieOf[V]) VisitSubtree(prefix []byte, visitor VisitorFuncOf[V]) error {
+	return pt.root.VisitSubtree(prefix, visitor)
+}
+
+func (pt *PersistentTrieOf[V]) VisitPrefixes(key []byte, visitor VisitorFuncOf[V]) error {
+	return pt.root.VisitPrefixes(key, visitor)
+}
+
+func (pt *PersistentTrieOf[V]) WalkRange(start, end Bound, visitor VisitorFuncOf[V]) error {
+	return pt.root.WalkRange(start, end, visitor)
+}
+
+func (pt *PersistentTrieOf[V]) WalkReverse(start, end Bound, visitor VisitorFuncOf[V]) error {
+	return pt.root.WalkReverse(start, end, visitor)
+}
+
+func (pt *PersistentTrieOf[V]) WalkContext(ctx context.Context, visitor VisitorFuncOf[V]) error {
+	return pt.root.WalkContext(ctx, visitor)
+}
+
+func (pt *PersistentTrieOf[V]) WalkPage(ctx context.Context, opts WalkOptions, visitor VisitorFuncOf[V]) ([]byte, error) {
+	return pt.root.WalkPage(ctx, opts, visitor)
+}
+
+func (pt *PersistentTrieOf[V]) Size() int {
+	return pt.root.Size()
+}
+
+func (pt *PersistentTrieOf[V]) CountPrefix(prefix []byte) int {
+	return pt.root.CountPrefix(prefix)
+}
+
+func (pt *PersistentTrieOf[V]) Rank(key []byte) int {
+	return pt.root.Rank(key)
+}
+
+func (pt *PersistentTrieOf[V]) Select(i int) (key []byte, item *V) {
+	return pt.root.Select(i)
+}
+
+func (pt *PersistentTrieOf[V]) Floor(key []byte) ([]byte, *V) {
+	return pt.root.Floor(key)
+}
+
+func (pt *PersistentTrieOf[V]) Ceil(key []byte) ([]byte, *V) {
+	return pt.root.Ceil(key)
+}
+
+func (pt *PersistentTrieOf[V]) LongestPrefix(key []byte) ([]byte, *V) {
+	return pt.root.LongestPrefix(key)
+}
+
+func (pt *PersistentTrieOf[V]) Empty() bool {
+	return pt.root.Empty()
+}
+
+// Root returns the Merkle root of this version. Versions share the cached
+// hashes of their common nodes, so only the copied paths are hashed again.
+func (pt *PersistentTrieOf[V]) Root() ([]byte, error) {
+	return pt.root.Root()
+}
+
+func (pt *PersistentTrieOf[V]) Prove(key []byte) (*Proof, error) {
+	return pt.root.Prove(key)
+}
+
+// Diff reports the differences between this version and a newer one, see the
+// Diff function. Nodes shared between the versions are skipped.
+func (pt *PersistentTrieOf[V]) Diff(newer *PersistentTrieOf[V], fn DiffFuncOf[V]) error {
+	return Diff(pt.root, newer.root, fn)
+}
+
+func (pt *PersistentTrieOf[V]) Marshal() ([]byte, error) {
+	return pt.root.Marshal()
+}
+
+func (pt *PersistentTrieOf[V]) WriteTo(w io.Writer) (int64, error) {
+	return pt.root.WriteTo(w)
+}
+
+func (pt *PersistentTrieOf[V]) SaveToFile(filename string, opts ...SaveOption) error {
+	return pt.root.SaveToFile(filename, opts...)
+}
+
+// Iterator returns an iterator over this version. Since versions never change
+// it stays valid while newer versions are created.
+func (pt *PersistentTrieOf[V]) Iterator() *IteratorOf[V] {
+	return pt.root.Iterator()
+}
@@ -0,0 +1,118 @@
+package indexer
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func assertItems(t *testing.T, pt *PersistentTrie, want map[string]Item) {
+	t.Helper()
+	if pt.Size() != len(want) {
+		t.Fatalf("want %d items, got %d", len(want), pt.Size())
+	}
+	for key, item := range want {
+		if got := pt.Get([]byte(key)); got == nil || *got != item {
+			t.Fatalf("key %x: want %v, got %v", key, item, got)
+		}
+	}
+}
+
+func TestPersistentTrieVersions(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	var (
+		versions []*PersistentTrie
+		oracles  []map[string]Item
+	)
+	pt, oracle := NewPersistentTrie(), map[string]Item{}
+	for block := 0; block < 50; block++ {
+		next := make(map[string]Item, len(oracle))
+		for k, v := range oracle {
+			next[k] = v
+		}
+		for i := 0; i < 40; i++ {
+			key := hashKey(rnd.Intn(300))[:1+rnd.Intn(3)]
+			item := Item{Pos: uint64(block), Length: uint64(i)}
+			switch rnd.Intn(4) {
+			case 0:
+				var inserted bool
+				pt, inserted = pt.Insert(key, &item)
+				if _, ok := next[string(key)]; ok == inserted {
+					t.Fatalf("Insert(%x) returned %v", key, inserted)
+				}
+				if inserted {
+					next[string(key)] = item
+				}
+			case 1:
+				pt = pt.Set(key, &item)
+				next[string(key)] = item
+			case 2:
+				var deleted bool
+				pt, deleted = pt.Delete(key)
+				if _, ok := next[string(key)]; ok != deleted {
+					t.Fatalf("Delete(%x) returned %v", key, deleted)
+				}
+				delete(next, string(key))
+			case 3:
+				if i%10 == 0 {
+					pt, _ = pt.DeleteSubtree(key[:1])
+					for k := range next {
+						if k[0] == key[0] {
+							delete(next, k)
+						}
+					}
+				}
+			}
+		}
+		versions = append(versions, pt)
+		oracles = append(oracles, next)
+		oracle = next
+	}
+
+	for i, version := range versions {
+		assertItems(t, version, oracles[i])
+	}
+
+	data, err := versions[10].Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertItems(t, Persist(loaded), oracles[10])
+}
+
+func TestPersistentTrieConcurrentVersions(t *testing.T) {
+	base := Persist(newHashTrie(1000))
+	want := map[string]Item{}
+	base.Visit(func(key []byte, item *Item) error {
+		want[string(key)] = *item
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		pt := base
+		for i := 0; i < 1000; i++ {
+			pt = pt.Set(hashKey(i), &Item{Pos: 1})
+			pt, _ = pt.Delete(hashKey(i + 500))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 3; i++ {
+			for key, item := range want {
+				if got := base.Get([]byte(key)); got == nil || *got != item {
+					t.Errorf("key %x: want %v, got %v", key, item, got)
+					return
+				}
+			}
+		}
+	}()
+	wg.Wait()
+	assertItems(t, base, want)
+}
@@ -0,0 +1,275 @@
+package indexer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// Proof shows that a key is stored in a trie with a given Merkle root, or that
+// it is absent from it, without the rest of the trie. It is produced by Prove
+// and checked by VerifyProof.
+//
+// A present key is proven by the path leading to it. An absent key is proven
+// by the paths to its neighbours, the greatest smaller key and the smallest
+// greater key, which must be adjacent in the trie. A neighbour is missing when
+// the key sorts before or after all keys.
+type Proof struct {
+	Path        *ProofPath // path to the key, nil for an absent key
+	Left, Right *ProofPath // paths to the neighbours of an absent key
+}
+
+// ProofPath lists the nodes from the root of a trie to a key, skipping the
+// nodes that only split long prefixes, as described in merkle.go.
+type ProofPath struct {
+	Label []byte // prefix leading to the first node
+	Nodes []ProofNode
+}
+
+// ProofNode is a node on a ProofPath.
+type ProofNode struct {
+	HasValue bool
+	Value    []byte // encoded by the ValueCodec of the trie
+
+	// Children holds every child in ascending order. The child the path
+	// continues with has a nil Hash, it is computed from the next node.
+	Children []ProofChild
+}
+
+// ProofChild is a child of a ProofNode.
+type ProofChild struct {
+	Label []byte
+	Hash  []byte
+}
+
+// Prove returns a proof of the presence or absence of key.
+func (trie *TrieOf[V]) Prove(key []byte) (*Proof, error) {
+	// Nil key not allowed.
+	if key == nil {
+		panic(ErrNilPrefix)
+	}
+
+	codec, err := trie.codec()
+	if err != nil {
+		return nil, err
+	}
+	if trie.Get(key) != nil {
+		return &Proof{Path: trie.provePath(codec, key)}, nil
+	}
+
+	proof := &Proof{}
+	it := trie.Iterator()
+	if it.Seek(key) {
+		proof.Right = trie.provePath(codec, it.Key())
+		if it.Prev() {
+			proof.Left = trie.provePath(codec, it.Key())
+		}
+	} else if it.Last() {
+		proof.Left = trie.provePath(codec, it.Key())
+	}
+	return proof, nil
+}
+
+// provePath returns the path to key, which must be stored in the trie.
+func (trie *TrieOf[V]) provePath(codec ValueCodec[V], key []byte) *ProofPath {
+	label, node := trie.label(nil)
+	path := &ProofPath{Label: label}
+	key = key[len(label):]
+	for node != nil {
+		proofNode := ProofNode{HasValue: node.Item != nil}
+		if node.Item != nil {
+			proofNode.Value = codec.AppendValue(nil, node.Item)
+		}
+
+		var next *TrieOf[V]
+		for _, child := range node.Children.appendChildren(nil) {
+			label, target := child.label(nil)
+			if next == nil && len(key) != 0 && bytes.HasPrefix(key, label) {
+				next, key = target, key[len(label):]
+				proofNode.Children = append(proofNode.Children, ProofChild{Label: label})
+				continue
+			}
+			sum := target.nodeHash(codec)
+			proofNode.Children = append(proofNode.Children, ProofChild{
+				Label: label,
+				Hash:  append([]byte{}, sum[:]...),
+			})
+		}
+		path.Nodes = append(path.Nodes, proofNode)
+		node = next
+	}
+	return path
+}
+
+// VerifyProof checks proof against the Merkle root of a Trie. It returns the
+// item stored under key, or nil when the proof shows that key is absent.
+func VerifyProof(root, key []byte, proof *Proof) (*Item, error) {
+	return VerifyProofOf[Item](ItemCodec{}, root, key, proof)
+}
+
+// VerifyProofOf is VerifyProof for a trie whose values are encoded by codec.
+func VerifyProofOf[V any](codec ValueCodec[V], root, key []byte, proof *Proof) (*V, error) {
+	if proof == nil {
+		return nil, fmt.Errorf("%w: no proof", ErrInvalidProof)
+	}
+
+	if proof.Path != nil {
+		if proof.Left != nil || proof.Right != nil {
+			return nil, fmt.Errorf("%w: both inclusion and exclusion", ErrInvalidProof)
+		}
+		pathKey, err := proof.Path.verify(root)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(pathKey, key) {
+			return nil, fmt.Errorf("%w: proof is for key %x", ErrInvalidProof, pathKey)
+		}
+		item, err := codec.DecodeValue(proof.Path.last().Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidProof, err)
+		}
+		return item, nil
+	}
+
+	left, right := proof.Left, proof.Right
+	if left == nil && right == nil {
+		empty := rootHash(nil, newNodeHash(nil, false).Sum(nil))
+		if !bytes.Equal(root, empty) {
+			return nil, fmt.Errorf("%w: trie is not empty", ErrInvalidProof)
+		}
+		return nil, nil
+	}
+	if left != nil {
+		leftKey, err := left.verify(root)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Compare(leftKey, key) >= 0 {
+			return nil, fmt.Errorf("%w: left neighbour %x does not precede key", ErrInvalidProof, leftKey)
+		}
+	}
+	if right != nil {
+		rightKey, err := right.verify(root)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Compare(rightKey, key) <= 0 {
+			return nil, fmt.Errorf("%w: right neighbour %x does not follow key", ErrInvalidProof, rightKey)
+		}
+	}
+	if !adjacent(left, right) {
+		return nil, fmt.Errorf("%w: neighbours are not adjacent", ErrInvalidProof)
+	}
+	return nil, nil
+}
+
+// verify checks that the path leads from root to a node holding a value, and
+// returns the key of that node.
+func (path *ProofPath) verify(root []byte) ([]byte, error) {
+	if len(path.Nodes) == 0 {
+		return nil, fmt.Errorf("%w: empty path", ErrInvalidProof)
+	}
+	if !path.last().HasValue {
+		return nil, fmt.Errorf("%w: path does not end at a value", ErrInvalidProof)
+	}
+
+	key := append([]byte{}, path.Label...)
+	for i := range path.Nodes {
+		next := path.next(i)
+		if (next == -1) != (i == len(path.Nodes)-1) {
+			return nil, fmt.Errorf("%w: broken path", ErrInvalidProof)
+		}
+		if next != -1 {
+			key = append(key, path.Nodes[i].Children[next].Label...)
+		}
+	}
+
+	var sum []byte
+	for i := len(path.Nodes) - 1; i >= 0; i-- {
+		node := &path.Nodes[i]
+		h := newNodeHash(node.Value, node.HasValue)
+		for j, child := range node.Children {
+			if j > 0 && bytes.Compare(node.Children[j-1].Label, child.Label) >= 0 {
+				return nil, fmt.Errorf("%w: unsorted children", ErrInvalidProof)
+			}
+			childSum := child.Hash
+			if childSum == nil {
+				childSum = sum
+			} else if len(childSum) != sha256.Size {
+				return nil, fmt.Errorf("%w: hash of %d bytes", ErrInvalidProof, len(childSum))
+			}
+			writeChild(h, child.Label, childSum)
+		}
+		sum = h.Sum(nil)
+	}
+	if !bytes.Equal(rootHash(path.Label, sum), root) {
+		return nil, fmt.Errorf("%w: root mismatch", ErrInvalidProof)
+	}
+	return key, nil
+}
+
+// next returns the index of the child the path continues with from the i-th
+// node, or -1 at the end of the path or when it is ambiguous.
+func (path *ProofPath) next(i int) int {
+	next := -1
+	for j, child := range path.Nodes[i].Children {
+		if child.Hash == nil {
+			if next != -1 {
+				return -1
+			}
+			next = j
+		}
+	}
+	return next
+}
+
+func (path *ProofPath) last() *ProofNode {
+	return &path.Nodes[len(path.Nodes)-1]
+}
+
+// adjacent reports whether there is no key between the keys proven by left
+// and right, both of which have been verified against the same root. A nil
+// path stands for the start or the end of the trie.
+func adjacent(left, right *ProofPath) bool {
+	// Find the last node shared by both paths. Their nodes are equal as long
+	// as they follow the same children, since they hash to the same root.
+	d := 0
+	if left != nil && right != nil {
+		for d+1 < len(left.Nodes) && d+1 < len(right.Nodes) && left.next(d) == right.next(d) {
+			d++
+		}
+	}
+
+	// Below the split the left path must take the last child and end at a
+	// node without children, the right one must take the first child and not
+	// pass a value.
+	leftFrom, rightFrom := 0, 0
+	if left != nil && right != nil {
+		switch l, r := left.next(d), right.next(d); {
+		case l == -1 && r == 0:
+			// The left key is the prefix where the paths split.
+		case l != -1 && r == l+1:
+		default:
+			return false
+		}
+		leftFrom, rightFrom = d+1, d+1
+	}
+	if left != nil {
+		for i := leftFrom; i < len(left.Nodes); i++ {
+			if left.next(i) != len(left.Nodes[i].Children)-1 {
+				return false
+			}
+		}
+	}
+	if right != nil {
+		for i := rightFrom; i < len(right.Nodes)-1; i++ {
+			if right.Nodes[i].HasValue || right.next(i) != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+var ErrInvalidProof = errors.New("invalid proof")
@@ -0,0 +1,105 @@
+package indexer
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestProveInclusion(t *testing.T) {
+	trie, keys := randomTrie(rand.New(rand.NewSource(6)), 1000)
+	root := mustRoot(t, trie)
+
+	for _, key := range keys {
+		proof, err := trie.Prove(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		item, err := VerifyProof(root, key, proof)
+		if err != nil {
+			t.Fatalf("key %x: %v", key, err)
+		}
+		if want := trie.Get(key); item == nil || *item != *want {
+			t.Fatalf("key %x: want %v, got %v", key, want, item)
+		}
+	}
+}
+
+func TestProveExclusion(t *testing.T) {
+	rnd := rand.New(rand.NewSource(7))
+	trie, _ := randomTrie(rnd, 1000)
+	root := mustRoot(t, trie)
+
+	for i := 0; i < 2000; i++ {
+		key := make([]byte, rnd.Intn(42))
+		for j := range key {
+			key[j] = byte(rnd.Intn(5)) * 50
+		}
+		if trie.Get(key) != nil {
+			continue
+		}
+		proof, err := trie.Prove(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		item, err := VerifyProof(root, key, proof)
+		if err != nil {
+			t.Fatalf("key %x: %v", key, err)
+		}
+		if item != nil {
+			t.Fatalf("key %x: unexpected item %v", key, item)
+		}
+	}
+
+	empty := NewTrie()
+	proof, err := empty.Prove([]byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyProof(mustRoot(t, empty), []byte("key"), proof); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyProofRejectsForgeries(t *testing.T) {
+	trie, keys := randomTrie(rand.New(rand.NewSource(8)), 500)
+	root := mustRoot(t, trie)
+	key := keys[100]
+
+	prove := func(key []byte) *Proof {
+		proof, err := trie.Prove(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return proof
+	}
+
+	tampered := prove(key)
+	last := tampered.Path.last()
+	last.Value = ItemCodec{}.AppendValue(nil, &Item{Pos: 1 << 40})
+
+	otherRoot := append([]byte{}, root...)
+	otherRoot[0] ^= 1
+
+	cases := []struct {
+		name  string
+		root  []byte
+		key   []byte
+		proof *Proof
+	}{
+		{"wrong key", root, keys[101], prove(key)},
+		{"tampered value", root, key, tampered},
+		{"wrong root", otherRoot, key, prove(key)},
+		{"skipped key", root, key, &Proof{Left: prove(keys[99]).Path, Right: prove(keys[101]).Path}},
+		{"missing left", root, key, &Proof{Right: prove(keys[101]).Path}},
+		{"missing right", root, key, &Proof{Left: prove(keys[99]).Path}},
+		{"empty", root, key, &Proof{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := VerifyProof(c.root, c.key, c.proof); !errors.Is(err, ErrInvalidProof) {
+				t.Fatalf("want %v, got %v", ErrInvalidProof, err)
+			}
+		})
+	}
+}
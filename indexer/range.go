@@ -0,0 +1,260 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+)
+
+// Bound limits one end of a range walk. A nil Key leaves that end open, the
+// empty key is a valid bound.
+type Bound struct {
+	Key       []byte
+	Exclusive bool
+}
+
+// Unbounded leaves an end of a range open.
+var Unbounded = Bound{}
+
+// Inclusive returns a bound including key in the range.
+func Inclusive(key []byte) Bound {
+	return Bound{Key: key}
+}
+
+// Exclusive returns a bound excluding key from the range.
+func Exclusive(key []byte) Bound {
+	return Bound{Key: key, Exclusive: true}
+}
+
+// WalkRange calls visitor on the items whose keys lie between start and end
+// in ascending order. Subtrees outside of the range are not visited.
+// ErrSkipSubtree works as in Walk.
+func (trie *TrieOf[V]) WalkRange(start, end Bound, visitor VisitorFuncOf[V]) error {
+	return trie.WalkRangeContext(context.Background(), start, end, visitor)
+}
+
+// WalkRangeContext works like WalkRange, but stops with the error of ctx once
+// it is done.
+func (trie *TrieOf[V]) WalkRangeContext(ctx context.Context, start, end Bound, visitor VisitorFuncOf[V]) error {
+	w := newRangeWalker(ctx, start, end, visitor)
+	return w.walk(trie)
+}
+
+// WalkContext works like Visit, but stops with the error of ctx once it is
+// done.
+func (trie *TrieOf[V]) WalkContext(ctx context.Context, visitor VisitorFuncOf[V]) error {
+	return trie.WalkRangeContext(ctx, Unbounded, Unbounded, visitor)
+}
+
+// WalkReverse calls visitor on the items whose keys lie between start and end
+// in descending order.
+//
+// A key comes after all the keys it is a prefix of in this order, so its
+// subtree has been visited already when the visitor returns ErrSkipSubtree
+// for it. The walk then simply goes on, as Walk does for a key without
+// descendants.
+func (trie *TrieOf[V]) WalkReverse(start, end Bound, visitor VisitorFuncOf[V]) error {
+	return trie.WalkReverseContext(context.Background(), start, end, visitor)
+}
+
+// WalkReverseContext works like WalkReverse, but stops with the error of ctx
+// once it is done.
+func (trie *TrieOf[V]) WalkReverseContext(ctx context.Context, start, end Bound, visitor VisitorFuncOf[V]) error {
+	w := newRangeWalker(ctx, start, end, visitor)
+	w.reverse = true
+	return w.walk(trie)
+}
+
+// WalkOptions selects a page of items for WalkPage.
+type WalkOptions struct {
+	// Limit is the maximum number of items visited, zero means no limit.
+	Limit int
+	// StartAfter resumes the walk after this key, usually the token
+	// returned for the previous page. Nil starts with the first item.
+	StartAfter []byte
+}
+
+// WalkPage visits up to opts.Limit items in ascending order, starting after
+// opts.StartAfter. It returns a continuation token to pass as StartAfter for
+// the next page, or nil once all items have been visited. Like
+// WalkRangeContext it stops with the error of ctx once it is done.
+//
+// When the visitor returns ErrSkipSubtree for the last item of a page, the
+// token is the greatest key below that item, so the next page skips the
+// subtree as well.
+func (trie *TrieOf[V]) WalkPage(ctx context.Context, opts WalkOptions, visitor VisitorFuncOf[V]) (token []byte, err error) {
+	start := Unbounded
+	if opts.StartAfter != nil {
+		start = Exclusive(opts.StartAfter)
+	}
+	w := newRangeWalker(ctx, start, Unbounded, visitor)
+	w.limit = opts.Limit
+	if err := w.walk(trie); err != nil {
+		return nil, err
+	}
+	if w.more {
+		return w.last, nil
+	}
+	return nil, nil
+}
+
+// rangeWalker keeps the state of the range walks.
+type rangeWalker[V any] struct {
+	ctx        context.Context
+	start, end Bound
+	visitor    VisitorFuncOf[V]
+	reverse    bool
+
+	limit   int    // maximum number of items visited, zero for no limit
+	visited int    // number of items visited
+	last    []byte // copy of the last visited key with a limit
+	more    bool   // items beyond the limit exist
+
+	key      []byte
+	children TriesOf[V] // children of the nodes on the current path
+}
+
+func newRangeWalker[V any](ctx context.Context, start, end Bound, visitor VisitorFuncOf[V]) *rangeWalker[V] {
+	return &rangeWalker[V]{ctx: ctx, start: start, end: end, visitor: visitor}
+}
+
+func (w *rangeWalker[V]) walk(trie *TrieOf[V]) error {
+	if err := w.walkNode(trie); err != nil && err != errLimitReached {
+		return err
+	}
+	return nil
+}
+
+// walkNode visits the subtree of node.
+func (w *rangeWalker[V]) walkNode(node *TrieOf[V]) error {
+	w.key = append(w.key, node.Prefix...)
+	defer func(n int) { w.key = w.key[:n] }(len(w.key) - len(node.Prefix))
+
+	// Every key of the subtree starts with w.key.
+	if w.before(w.key) || w.after(w.key) {
+		return nil
+	}
+	select {
+	case <-w.ctx.Done():
+		return w.ctx.Err()
+	default:
+	}
+
+	visit := func() error {
+		if node.Item == nil || !w.contains(w.key) {
+			return nil
+		}
+		if w.limit == 0 {
+			return w.visitor(w.key, node.Item)
+		}
+		if w.visited == w.limit {
+			w.more = true
+			return errLimitReached
+		}
+		w.visited++
+		w.last = append(w.last[:0], w.key...)
+		err := w.visitor(w.key, node.Item)
+		if err == ErrSkipSubtree {
+			w.last = node.appendLastKey(w.last)
+		}
+		return err
+	}
+
+	if !w.reverse {
+		if err := visit(); err != nil {
+			if err == ErrSkipSubtree {
+				return nil
+			}
+			return err
+		}
+	}
+
+	first := len(w.children)
+	w.children = node.Children.appendChildren(w.children)
+	defer func() { w.children = w.children[:first] }()
+	last := len(w.children)
+
+	for i := first; i < last; i++ {
+		j := i
+		if w.reverse {
+			j = first + last - 1 - i
+		}
+		if err := w.walkNode(w.children[j]); err != nil {
+			return err
+		}
+	}
+
+	if w.reverse {
+		// The subtree has been visited, there is nothing left to skip.
+		if err := visit(); err != nil && err != ErrSkipSubtree {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendLastKey appends the rest of the greatest key in the subtree of the
+// node to key, the key of the node.
+func (trie *TrieOf[V]) appendLastKey(key []byte) []byte {
+	for node := trie; node.Children.length() != 0; {
+		n := node.count
+		if node.Item != nil {
+			n--
+		}
+		node, _ = node.Children.childAt(n - 1)
+		key = append(key, node.Prefix...)
+	}
+	return key
+}
+
+// before reports whether all keys starting with prefix sort before the start
+// of the range.
+func (w *rangeWalker[V]) before(prefix []byte) bool {
+	if w.start.Key == nil {
+		return false
+	}
+	n := len(prefix)
+	if n > len(w.start.Key) {
+		n = len(w.start.Key)
+	}
+	return bytes.Compare(prefix[:n], w.start.Key[:n]) < 0
+}
+
+// after reports whether all keys starting with prefix sort after the end of
+// the range.
+func (w *rangeWalker[V]) after(prefix []byte) bool {
+	if w.end.Key == nil {
+		return false
+	}
+	n := len(prefix)
+	if n > len(w.end.Key) {
+		n = len(w.end.Key)
+	}
+	switch c := bytes.Compare(prefix[:n], w.end.Key[:n]); {
+	case c != 0:
+		return c > 0
+	case len(prefix) > len(w.end.Key):
+		// The end is a proper prefix of every key.
+		return true
+	default:
+		return len(prefix) == len(w.end.Key) && w.end.Exclusive
+	}
+}
+
+// contains reports whether key lies within the range.
+func (w *rangeWalker[V]) contains(key []byte) bool {
+	if w.start.Key != nil {
+		if c := bytes.Compare(key, w.start.Key); c < 0 || c == 0 && w.start.Exclusive {
+			return false
+		}
+	}
+	if w.end.Key != nil {
+		if c := bytes.Compare(key, w.end.Key); c > 0 || c == 0 && w.end.Exclusive {
+			return false
+		}
+	}
+	return true
+}
+
+// errLimitReached stops a walk once the limit of items has been visited.
+var errLimitReached = errors.New("limit reached")
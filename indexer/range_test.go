@@ -0,0 +1,231 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func collectRange(t *testing.T, trie *Trie, start, end Bound, reverse bool) [][]byte {
+	t.Helper()
+	var keys [][]byte
+	visitor := func(key []byte, item *Item) error {
+		if item != trie.Get(key) {
+			t.Fatalf("key %x visited with a wrong item", key)
+		}
+		keys = append(keys, append([]byte{}, key...))
+		return nil
+	}
+	walk := trie.WalkRange
+	if reverse {
+		walk = trie.WalkReverse
+	}
+	if err := walk(start, end, visitor); err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestWalkRange(t *testing.T) {
+	rnd := rand.New(rand.NewSource(21))
+	trie, keys := randomTrie(rnd, 400)
+
+	randomBound := func() Bound {
+		switch rnd.Intn(4) {
+		case 0:
+			return Unbounded
+		case 1:
+			return Inclusive(keys[rnd.Intn(len(keys))])
+		}
+		key := make([]byte, rnd.Intn(6))
+		for i := range key {
+			key[i] = byte(rnd.Intn(5)) * 50
+		}
+		return Bound{Key: key, Exclusive: rnd.Intn(2) == 0}
+	}
+	inRange := func(key []byte, start, end Bound) bool {
+		if start.Key != nil {
+			if c := bytes.Compare(key, start.Key); c < 0 || c == 0 && start.Exclusive {
+				return false
+			}
+		}
+		if end.Key != nil {
+			if c := bytes.Compare(key, end.Key); c > 0 || c == 0 && end.Exclusive {
+				return false
+			}
+		}
+		return true
+	}
+
+	for i := 0; i < 300; i++ {
+		start, end := randomBound(), randomBound()
+		var want [][]byte
+		for _, key := range keys {
+			if inRange(key, start, end) {
+				want = append(want, key)
+			}
+		}
+
+		if got := collectRange(t, trie, start, end, false); len(got)+len(want) != 0 && !reflect.DeepEqual(got, want) {
+			t.Fatalf("range %x %v - %x %v: want %d keys, got %d", start.Key, start.Exclusive, end.Key, end.Exclusive, len(want), len(got))
+		}
+		for i, j := 0, len(want)-1; i < j; i, j = i+1, j-1 {
+			want[i], want[j] = want[j], want[i]
+		}
+		if got := collectRange(t, trie, start, end, true); len(got)+len(want) != 0 && !reflect.DeepEqual(got, want) {
+			t.Fatalf("reverse %x %v - %x %v: want %d keys, got %d", start.Key, start.Exclusive, end.Key, end.Exclusive, len(want), len(got))
+		}
+	}
+}
+
+func TestWalkRangeSkipSubtree(t *testing.T) {
+	trie := NewTrie()
+	for _, key := range []string{"a", "ab", "abc", "abd", "b", "ba", "bb", "c"} {
+		trie.Insert([]byte(key), &Item{})
+	}
+	walk := func(walk func(Bound, Bound, VisitorFunc) error, skip string) string {
+		var visited []byte
+		walk(Unbounded, Exclusive([]byte("c")), func(key []byte, _ *Item) error {
+			visited = append(append(visited, key...), ' ')
+			if string(key) == skip {
+				return ErrSkipSubtree
+			}
+			return nil
+		})
+		return string(visited)
+	}
+
+	if got := walk(trie.WalkRange, "ab"); got != "a ab b ba bb " {
+		t.Fatalf("forward: got %q", got)
+	}
+	// In reverse the subtree of a key has been visited before the key, so
+	// nothing is skipped: neither siblings of a leaf nor the keys above.
+	for _, skip := range []string{"abd", "bb", "ab", "a"} {
+		if got := walk(trie.WalkReverse, skip); got != "bb ba b abd abc ab a " {
+			t.Fatalf("reverse skipping %s: got %q", skip, got)
+		}
+	}
+
+	// The sibling leaves a, b and c under the root.
+	leaves := NewTrie()
+	for _, key := range []string{"a", "b", "c"} {
+		leaves.Insert([]byte(key), &Item{})
+	}
+	var visited []string
+	leaves.WalkReverse(Unbounded, Unbounded, func(key []byte, _ *Item) error {
+		visited = append(visited, string(key))
+		return ErrSkipSubtree
+	})
+	if strings.Join(visited, " ") != "c b a" {
+		t.Fatalf("reverse with skipped leaves: got %q", visited)
+	}
+}
+
+func TestWalkPage(t *testing.T) {
+	trie, keys := randomTrie(rand.New(rand.NewSource(22)), 300)
+	ctx := context.Background()
+
+	for _, limit := range []int{1, 7, 100, len(keys), len(keys) + 1} {
+		var (
+			got   [][]byte
+			token []byte
+			pages int
+		)
+		for {
+			n := 0
+			next, err := trie.WalkPage(ctx, WalkOptions{Limit: limit, StartAfter: token}, func(key []byte, _ *Item) error {
+				got = append(got, append([]byte{}, key...))
+				n++
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n > limit || next != nil && n != limit {
+				t.Fatalf("limit %d: page of %d items", limit, n)
+			}
+			pages++
+			if next == nil {
+				break
+			}
+			token = next
+		}
+		if !reflect.DeepEqual(got, keys) {
+			t.Fatalf("limit %d: pages hold %d keys, want %d", limit, len(got), len(keys))
+		}
+		if want := (len(keys) + limit - 1) / limit; pages != want {
+			t.Fatalf("limit %d: %d pages, want %d", limit, pages, want)
+		}
+	}
+
+	var n int
+	token, err := trie.WalkPage(ctx, WalkOptions{}, func([]byte, *Item) error { n++; return nil })
+	if err != nil || token != nil || n != len(keys) {
+		t.Fatalf("unlimited page: %d items, token %x, %v", n, token, err)
+	}
+}
+
+func TestWalkPageSkipSubtree(t *testing.T) {
+	trie := NewTrie()
+	for _, key := range []string{"a", "ab", "abc", "ac", "b", "ba"} {
+		trie.Insert([]byte(key), &Item{})
+	}
+	ctx := context.Background()
+
+	// The subtree skipped on the last item of a page stays skipped on the
+	// next page.
+	var got []string
+	token, err := trie.WalkPage(ctx, WalkOptions{Limit: 2}, func(key []byte, _ *Item) error {
+		got = append(got, string(key))
+		if string(key) == "ab" {
+			return ErrSkipSubtree
+		}
+		return nil
+	})
+	if err != nil || string(token) != "abc" {
+		t.Fatalf("token %q, %v", token, err)
+	}
+	token, err = trie.WalkPage(ctx, WalkOptions{Limit: 1, StartAfter: token}, func(key []byte, _ *Item) error {
+		got = append(got, string(key))
+		return ErrSkipSubtree
+	})
+	if err != nil || string(token) != "ac" {
+		t.Fatalf("token %q, %v", token, err)
+	}
+	token, err = trie.WalkPage(ctx, WalkOptions{Limit: 1, StartAfter: token}, func(key []byte, _ *Item) error {
+		got = append(got, string(key))
+		return ErrSkipSubtree
+	})
+	// Nothing is left after the skipped subtree.
+	if err != nil || token != nil {
+		t.Fatalf("token %q, %v", token, err)
+	}
+	if want := []string{"a", "ab", "ac", "b"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("visited %q, want %q", got, want)
+	}
+}
+
+func TestWalkContextCancel(t *testing.T) {
+	ct := NewConcurrentTrieFrom(newHashTrie(1000))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := 0
+	err := ct.WalkContext(ctx, func([]byte, *Item) error {
+		if n++; n == 10 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || n != 10 {
+		t.Fatalf("walk stopped after %d items with %v", n, err)
+	}
+
+	if _, err := ct.WalkPage(ctx, WalkOptions{Limit: 5}, func([]byte, *Item) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Fatalf("want %v, got %v", context.Canceled, err)
+	}
+}
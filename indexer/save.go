@@ -0,0 +1,120 @@
+package indexer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// SaveOption configures SaveToFile and SaveIndexToFile.
+type SaveOption func(*saveSettings)
+
+type saveSettings struct {
+	backups int
+}
+
+// WithBackups keeps the last n versions of the file replaced by a save,
+// named after it with ".1" for the most recent up to ".n" for the oldest.
+func WithBackups(n int) SaveOption {
+	return func(s *saveSettings) { s.backups = n }
+}
+
+// writeFile replaces filename with the output of write so that a crash
+// leaves either the old or the new file in place, never a partial one. The
+// output goes to a temporary file in the same directory, which is synced and
+// renamed over filename before the directory is synced as well.
+func writeFile(filename string, write func(w io.Writer) error, opts []SaveOption) (err error) {
+	var s saveSettings
+	for _, opt := range opts {
+		opt(&s)
+	}
+	if s.backups < 0 {
+		return fmt.Errorf("%w: %d backups", ErrInvalidOption, s.backups)
+	}
+
+	// The temporary file must be next to filename for the rename to be
+	// atomic, not in the default directory of CreateTemp.
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := os.CreateTemp(dir, base+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+	if err = write(w); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = f.Chmod(0644); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	if s.backups > 0 {
+		if err = rotateBackups(filename, s.backups); err != nil {
+			return err
+		}
+	}
+	if err = os.Rename(f.Name(), filename); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// rotateBackups shifts the backups of filename by one generation, dropping
+// the oldest, and links the current file as the most recent backup. The file
+// itself stays in place until it is replaced.
+func rotateBackups(filename string, n int) error {
+	backup := func(i int) string { return fmt.Sprintf("%s.%d", filename, i) }
+
+	if _, err := os.Stat(filename); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := os.Remove(backup(n)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for i := n - 1; i > 0; i-- {
+		if err := os.Rename(backup(i), backup(i+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Link(filename, backup(1))
+}
+
+// syncDir makes the renames within dir durable.
+func syncDir(dir string) error {
+	if dir == "" {
+		dir = "."
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,117 @@
+package indexer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// assertDir checks that dir holds exactly the files named in want.
+func assertDir(t *testing.T, dir string, want ...string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Name())
+	}
+	if len(got) != len(want) {
+		t.Fatalf("directory holds %q, want %q", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("directory holds %q, want %q", got, want)
+		}
+	}
+}
+
+func TestSaveToFileBackups(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "h1")
+
+	var versions []*Trie
+	for i := 1; i <= 4; i++ {
+		trie := newHashTrie(10 * i)
+		if err := trie.SaveToFile(filename, WithBackups(2)); err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, trie)
+	}
+	assertDir(t, dir, "h1", "h1.1", "h1.2")
+
+	for i, name := range []string{"h1", "h1.1", "h1.2"} {
+		loaded := NewTrie()
+		if err := loaded.ReadFromFile(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+		assertSameItems(t, versions[len(versions)-1-i], loaded)
+	}
+
+	// Without the option the backups are left alone.
+	if err := newHashTrie(5).SaveToFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	assertDir(t, dir, "h1", "h1.1", "h1.2")
+}
+
+func TestSaveToFileFailure(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "h1")
+	want := newHashTrie(10)
+	if err := want.SaveToFile(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	// A trie without codec cannot be written, the file stays intact.
+	if err := NewTrieOf[string](nil).SaveToFile(filename, WithBackups(1)); !errors.Is(err, ErrNoCodec) {
+		t.Fatalf("want %v, got %v", ErrNoCodec, err)
+	}
+	if err := want.SaveIndexToFile(filename, WithBackups(-1)); !errors.Is(err, ErrInvalidOption) {
+		t.Fatalf("want %v, got %v", ErrInvalidOption, err)
+	}
+	assertDir(t, dir, "h1")
+
+	loaded := NewTrie()
+	if err := loaded.ReadFromFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, want, loaded)
+
+	if err := want.SaveToFile(filepath.Join(dir, "missing", "h1")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("want %v, got %v", os.ErrNotExist, err)
+	}
+}
+
+func TestSaveToFileRelative(t *testing.T) {
+	// The default directory for temporary files does not even exist, the
+	// file is written next to the target.
+	dir, tmp := t.TempDir(), t.TempDir()
+	t.Setenv("TMPDIR", filepath.Join(tmp, "missing"))
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	want := newHashTrie(10)
+	if err := want.SaveToFile("h1", WithBackups(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := want.SaveToFile("h1", WithBackups(1)); err != nil {
+		t.Fatal(err)
+	}
+	assertDir(t, dir, "h1", "h1.1")
+	assertDir(t, tmp)
+
+	loaded := NewTrie()
+	if err := loaded.ReadFromFile("h1"); err != nil {
+		t.Fatal(err)
+	}
+	assertSameItems(t, want, loaded)
+}
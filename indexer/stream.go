@@ -0,0 +1,263 @@
+package indexer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/valyala/gozstd"
+)
+
+// WriteTo streams the trie to w in the file format described in format.go.
+// Records are compressed as they are produced, so memory use does not grow
+// with the size of the trie.
+func (trie *TrieOf[V]) WriteTo(w io.Writer) (int64, error) {
+	codec, err := trie.codec()
+	if err != nil {
+		return 0, err
+	}
+	header := trie.fileHeader(codec)
+	cw := &checksumWriter{w: w}
+	if _, err := cw.Write(header.encode()); err != nil {
+		return cw.n, err
+	}
+
+	bw := newBlockWriter(cw)
+	var payload io.Writer = bw
+	if header.codec == codecZstd {
+		zw := gozstd.NewWriterLevel(bw, header.options.compressionLevel)
+		defer zw.Release()
+		payload = zw
+	}
+
+	var record, value []byte
+	err = trie.Walk(nil, func(prefix []byte, item *V) error {
+		value = codec.AppendValue(value[:0], item)
+		record = header.appendRecord(record[:0], prefix, value)
+		_, err := payload.Write(record)
+		return err
+	})
+	if err != nil {
+		return cw.n, err
+	}
+	if zw, ok := payload.(*gozstd.Writer); ok {
+		if err = zw.Close(); err != nil {
+			return cw.n, err
+		}
+	}
+	if err = bw.Close(); err != nil {
+		return cw.n, err
+	}
+
+	n, err := w.Write(appendUint32(nil, cw.sum))
+	return cw.n + int64(n), err
+}
+
+// ReadFrom loads the items serialized by WriteTo from r and inserts them into
+// the trie. The trie is only modified once the whole input has been read and
+// verified. ReadFrom does not read past the end of the serialized trie.
+//
+// An empty trie takes over the options stored in the file, except for the
+// value codec, so that it gets the shape of the trie that was written. A trie
+// that already holds items keeps its own.
+func (trie *TrieOf[V]) ReadFrom(r io.Reader) (int64, error) {
+	loaded, n, err := trie.load(r, trie.Empty())
+	if err != nil {
+		return n, err
+	}
+	trie.add(loaded)
+	return n, nil
+}
+
+// load reads a serialized trie from r into a new trie with the settings of
+// this one, or with those stored in the file when adopt is set.
+func (trie *TrieOf[V]) load(r io.Reader, adopt bool) (*TrieOf[V], int64, error) {
+	cr := &checksumReader{r: r}
+	loaded := trie.newNode()
+	if err := loaded.readFile(cr, adopt); err != nil {
+		return nil, cr.n, err
+	}
+	return loaded, cr.n, nil
+}
+
+// add merges a trie returned by load into this one, which takes over its
+// settings when it is empty.
+func (trie *TrieOf[V]) add(loaded *TrieOf[V]) {
+	if trie.Empty() && loaded.cfg != trie.cfg {
+		trie.cfg = loaded.cfg
+		trie.reset()
+	}
+	trie.Merge(loaded, nil)
+}
+
+// readFile loads the file into the trie, which must be empty. With adopt set
+// the trie switches to the options stored in the file.
+func (trie *TrieOf[V]) readFile(cr *checksumReader, adopt bool) error {
+	buf := make([]byte, headerSize)
+	if _, err := io.ReadFull(cr, buf[:8]); err != nil {
+		return unexpectedEOF(err)
+	}
+	if Stoi(buf[:8]) != magicNumber {
+		return ErrInvalidMagic
+	}
+	if _, err := io.ReadFull(cr, buf[8:12]); err != nil {
+		return unexpectedEOF(err)
+	}
+	if isLegacy(buf[:12]) {
+		// Legacy files were written with the default options.
+		if adopt {
+			trie.adoptSettings(defaultSettings())
+		}
+		return trie.readRecords(io.MultiReader(bytes.NewReader(buf[8:12]), cr), legacyHeader, -1)
+	}
+	if _, err := io.ReadFull(cr, buf[12:]); err != nil {
+		return unexpectedEOF(err)
+	}
+	header, err := decodeHeader(buf)
+	if err != nil {
+		return err
+	}
+	options := defaultSettings()
+	if header.flags&flagOptions != 0 {
+		if _, err := io.ReadFull(cr, buf[:optionsSize]); err != nil {
+			return unexpectedEOF(err)
+		}
+		if err := header.decodeOptions(buf[:optionsSize]); err != nil {
+			return err
+		}
+		options = header.options
+	}
+	if adopt {
+		trie.adoptSettings(options)
+	}
+
+	switch header.version {
+	case formatVersion1:
+		br := &blockReader{r: cr}
+		if err := trie.readRecords(br, header, int64(header.count)); err != nil {
+			return err
+		}
+		if _, err := io.Copy(io.Discard, br); err != nil {
+			return err
+		}
+	case formatVersion2:
+		if err := trie.readIndexPayload(cr, header); err != nil {
+			return err
+		}
+	}
+
+	sum := cr.sum
+	if _, err := io.ReadFull(cr, buf[:checksumSize]); err != nil {
+		return unexpectedEOF(err)
+	}
+	if binary.BigEndian.Uint32(buf) != sum {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// adoptSettings switches the trie, which must be empty, to the options s.
+func (trie *TrieOf[V]) adoptSettings(s settings) {
+	trie.cfg = trie.cfg.withSettings(s)
+	trie.reset()
+}
+
+// readRecords builds the trie, which must be empty, from the records read from
+// the payload in r. A negative count disables checking the number of records.
+func (trie *TrieOf[V]) readRecords(r io.Reader, header fileHeader, count int64) error {
+	codec, err := trie.codec()
+	if err != nil {
+		return err
+	}
+	header.valueSize = codec.Size()
+
+	src := r
+	if header.codec == codecZstd {
+		zr := gozstd.NewReader(r)
+		defer zr.Release()
+		r = zr
+	}
+
+	br := bufio.NewReader(r)
+	builder := newBuilder(trie)
+	var (
+		n   int64
+		buf []byte
+	)
+	for {
+		key, value, err := header.readRecord(br, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if blocks, ok := src.(*blockReader); ok && blocks.err != nil {
+				return blocks.err
+			}
+			if errors.Is(err, ErrTruncated) || errors.Is(err, ErrCorrupted) {
+				return err
+			}
+			return fmt.Errorf("%w: %v", ErrCorrupted, err)
+		}
+		item, err := codec.DecodeValue(value)
+		if err != nil {
+			return err
+		}
+		if err := builder.Add(key, item); err != nil {
+			return fmt.Errorf("%w: %v", ErrCorrupted, err)
+		}
+		buf = value
+		n++
+	}
+	if count >= 0 && n != count {
+		return fmt.Errorf("%w: expected %d items, found %d", ErrCorrupted, count, n)
+	}
+	return nil
+}
+
+// fileHeader describes how the trie is going to be serialized. Keys are stored
+// with a fixed length when they all have the same one, otherwise each key is
+// prefixed with its length. The same goes for values of a codec without a
+// fixed size. Options other than the defaults are stored along.
+func (trie *TrieOf[V]) fileHeader(codec ValueCodec[V]) fileHeader {
+	var (
+		count  uint64
+		keyLen = -1
+		varLen bool
+	)
+	trie.Walk(nil, func(prefix []byte, _ *V) error {
+		if keyLen == -1 {
+			keyLen = len(prefix)
+		} else if len(prefix) != keyLen {
+			varLen = true
+		}
+		count++
+		return nil
+	})
+
+	header := fileHeader{
+		version: formatVersion1,
+		codec:   codecZstd,
+		count:   count,
+		options: trie.cfg.settings,
+	}
+	if header.options.compressionLevel == 0 {
+		header.codec = codecNone
+	}
+	if !header.options.isDefault() {
+		header.flags |= flagOptions
+	}
+	switch {
+	case varLen || keyLen > math.MaxUint16:
+		header.flags |= flagVarKeys
+	case keyLen > 0:
+		header.keyLen = uint16(keyLen)
+	}
+	if header.valueSize = codec.Size(); header.valueSize == 0 {
+		header.flags |= flagVarValues
+	}
+	return header
+}
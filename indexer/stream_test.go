@@ -0,0 +1,58 @@
+package indexer
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestWriteToReadFromConcatenated(t *testing.T) {
+	first, second := newHashTrie(3000), NewTrie()
+	second.Insert([]byte("0x111234"), &Item{Pos: 1, Length: 2})
+
+	var buffer bytes.Buffer
+	for _, trie := range []*Trie{first, second} {
+		n, err := trie.WriteTo(&buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			t.Fatal("nothing written")
+		}
+	}
+	total := int64(buffer.Len())
+
+	r := bytes.NewReader(buffer.Bytes())
+	var read int64
+	for _, want := range []*Trie{first, second} {
+		loaded := NewTrie()
+		n, err := loaded.ReadFrom(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		read += n
+		assertSameItems(t, want, loaded)
+	}
+	if read != total {
+		t.Fatalf("read %d bytes out of %d", read, total)
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestReadFromKeepsTrieOnError(t *testing.T) {
+	data, err := newHashTrie(100).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trie := NewTrie()
+	trie.Insert([]byte("key"), &Item{Pos: 1, Length: 1})
+	if _, err := trie.ReadFrom(bytes.NewReader(data[:len(data)-10])); err == nil {
+		t.Fatal("expected an error")
+	}
+	if trie.Size() != 1 {
+		t.Fatalf("trie modified by failed read: %d items", trie.Size())
+	}
+}
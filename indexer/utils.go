@@ -1,44 +1,18 @@
 package indexer
 
 import (
-	"bufio"
-	"bytes"
 	"encoding/binary"
-	"fmt"
 	"unsafe"
-
-	"github.com/valyala/gozstd"
 )
 
 func Marshal(trie *Trie) ([]byte, error) {
-	var buffer bytes.Buffer
-	buffer.Reset()
-	trie.Walk(nil, func(prefix []byte, item *Item) error {
-		buffer.Write(prefix)
-		buffer.Write(Itos(item.Pos))
-		buffer.Write(Itos(item.Length))
-		return nil
-	})
-	return gozstd.Compress(nil, buffer.Bytes()), nil
+	return trie.Marshal()
 }
 
 func Unmarshal(data []byte) (*Trie, error) {
-	if len(data) == 0 {
-		return nil, fmt.Errorf("data is empty")
-	}
-	ds, err := gozstd.Decompress(nil, data)
-	if err != nil {
-		return nil, err
-	}
 	trie := NewTrie()
-	scanner := bufio.NewScanner(bytes.NewReader(ds))
-	scanner.Split(ScanData)
-	var line, key []byte
-	for scanner.Scan() {
-		line = scanner.Bytes()
-		key = make([]byte, 32)
-		copy(key, line[:32])
-		trie.Insert(key, &Item{Pos: Stoi(line[32:40]), Length: Stoi(line[40:48])})
+	if err := trie.Unmarshal(data); err != nil {
+		return nil, err
 	}
 	return trie, nil
 }
@@ -0,0 +1,154 @@
+package indexer
+
+import (
+	"fmt"
+)
+
+// Validate checks the structural invariants of the trie and returns an error
+// wrapping ErrInvalidTree describing the first violation found:
+//
+//   - prefixes are at most as long as the trie allows, and not empty below
+//     the root
+//   - every node below the root holds an item or has children
+//   - no node could be compacted with its only child
+//   - child lists are consistent with the first bytes of their children,
+//     sorted and of the kind their size calls for
+//   - item counts match the subtrees
+//   - all nodes share the settings of the root
+//
+// It is meant for tests and debugging and visits the whole trie.
+func (trie *TrieOf[V]) Validate() error {
+	_, err := trie.validate(trie.cfg, nil, true)
+	return err
+}
+
+// validate checks the subtree of the node, whose key starts with key. It
+// returns the number of items in the subtree.
+func (trie *TrieOf[V]) validate(cfg *config[V], key []byte, root bool) (int, error) {
+	key = append(key, trie.Prefix...)
+	fail := func(format string, args ...any) (int, error) {
+		return 0, fmt.Errorf("%w: node %x: %s", ErrInvalidTree, key, fmt.Sprintf(format, args...))
+	}
+
+	switch {
+	case trie.cfg != cfg:
+		return fail("settings differ from the root")
+	case trie.Children == nil:
+		return fail("no child list")
+	case len(trie.Prefix) > trie.maxPrefix():
+		return fail("prefix of %d bytes, at most %d allowed", len(trie.Prefix), trie.maxPrefix())
+	case !root && len(trie.Prefix) == 0:
+		return fail("empty prefix")
+	case !root && trie.Item == nil && trie.Children.length() == 0:
+		return fail("neither item nor children")
+	case trie.compact() != trie:
+		return fail("not compacted with its only child")
+	}
+	if err := trie.Children.validate(trie.maxSparse()); err != nil {
+		return fail("%v", err)
+	}
+
+	count := 0
+	if trie.Item != nil {
+		count++
+	}
+	for _, child := range trie.Children.appendChildren(nil) {
+		n, err := child.validate(cfg, key, false)
+		if err != nil {
+			return 0, err
+		}
+		count += n
+	}
+	if count != trie.count {
+		return fail("count %d, subtree holds %d items", trie.count, count)
+	}
+	return count, nil
+}
+
+// validate checks the children are sorted, match the keys and fit the list.
+func (list *SparseChildListOf[V]) validate(max int) error {
+	switch {
+	case list.max != max:
+		return fmt.Errorf("sparse list limited to %d children instead of %d", list.max, max)
+	case len(list.Children) > max:
+		return fmt.Errorf("%d children in a sparse list", len(list.Children))
+	case len(list.keys) != len(list.Children):
+		return fmt.Errorf("%d keys for %d children", len(list.keys), len(list.Children))
+	}
+	for i, child := range list.Children {
+		if err := validateChild(child, list.keys[i]); err != nil {
+			return err
+		}
+		if i != 0 && list.keys[i-1] >= list.keys[i] {
+			return fmt.Errorf("children %02x and %02x out of order", list.keys[i-1], list.keys[i])
+		}
+	}
+	return nil
+}
+
+// validate checks that the index and the slots in use agree.
+func (list *IndexedChildListOf[V]) validate(max int) error {
+	switch {
+	case list.max != max:
+		return fmt.Errorf("indexed list created for %d sparse children instead of %d", list.max, max)
+	case list.NumChildren <= max/2 || list.NumChildren > maxIndexedChildren:
+		return fmt.Errorf("%d children in an indexed list", list.NumChildren)
+	}
+
+	var used [maxIndexedChildren]bool
+	for b, i := range list.Index {
+		if i == 0 {
+			continue
+		}
+		if int(i) > list.NumChildren || used[i-1] {
+			return fmt.Errorf("index %d of %02x invalid", i, b)
+		}
+		used[i-1] = true
+		if err := validateChild(list.Children[i-1], byte(b)); err != nil {
+			return err
+		}
+	}
+	for i, child := range list.Children {
+		if (i < list.NumChildren) != used[i] || (i >= list.NumChildren && child != nil) {
+			return fmt.Errorf("slot %d of %d children misused", i, list.NumChildren)
+		}
+	}
+	return nil
+}
+
+// validate checks that every child sits in the slot of its first byte.
+func (list *DenseChildListOf[V]) validate(max int) error {
+	if list.max != max {
+		return fmt.Errorf("dense list created for %d sparse children instead of %d", list.max, max)
+	}
+	n := 0
+	for b, child := range list.Children {
+		if child == nil {
+			continue
+		}
+		if err := validateChild(child, byte(b)); err != nil {
+			return err
+		}
+		n++
+	}
+	switch {
+	case n != list.NumChildren:
+		return fmt.Errorf("%d children counted as %d", n, list.NumChildren)
+	case n <= denseShrinkChildren:
+		return fmt.Errorf("%d children in a dense list", n)
+	}
+	return nil
+}
+
+// validateChild checks that child is stored under b.
+func validateChild[V any](child *TrieOf[V], b byte) error {
+	switch {
+	case child == nil:
+		return fmt.Errorf("nil child under %02x", b)
+	case len(child.Prefix) == 0:
+		return fmt.Errorf("child under %02x with empty prefix", b)
+	case child.Prefix[0] != b:
+		return fmt.Errorf("child %x stored under %02x", child.Prefix, b)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package indexer
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// applyOps decodes data into a sequence of modifications, applies them to a
+// trie and to a map and checks that both agree after every step.
+func applyOps(t *testing.T, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	var opts []Option
+	if data[0]&1 != 0 {
+		opts = append(opts, WithMaxPrefixPerNode(2), WithMaxChildrenPerSparseNode(2))
+	}
+	data = data[1:]
+
+	trie := NewTrie(opts...)
+	oracle := make(map[string]*Item)
+	for step := 0; len(data) >= 2; step++ {
+		op, n := data[0], int(data[1]%8)
+		data = data[2:]
+		if n > len(data) {
+			n = len(data)
+		}
+		// Keys use a small alphabet so that they share prefixes.
+		key := make([]byte, n)
+		for i, b := range data[:n] {
+			key[i] = 'a' + b%4
+		}
+		data = data[n:]
+
+		item := &Item{Pos: uint64(step)}
+		switch op % 4 {
+		case 0:
+			_, exists := oracle[string(key)]
+			if inserted := trie.Insert(key, item); inserted == exists {
+				t.Fatalf("step %d: insert %q returned %v", step, key, inserted)
+			}
+			if !exists {
+				oracle[string(key)] = item
+			}
+		case 1:
+			trie.Set(key, item)
+			oracle[string(key)] = item
+		case 2:
+			_, exists := oracle[string(key)]
+			if deleted := trie.Delete(key); deleted != exists {
+				t.Fatalf("step %d: delete %q returned %v", step, key, deleted)
+			}
+			delete(oracle, string(key))
+		case 3:
+			removed := false
+			for k := range oracle {
+				if strings.HasPrefix(k, string(key)) {
+					delete(oracle, k)
+					removed = true
+				}
+			}
+			if deleted := trie.DeleteSubtree(key); deleted != removed {
+				t.Fatalf("step %d: delete subtree %q returned %v", step, key, deleted)
+			}
+		}
+
+		if err := trie.Validate(); err != nil {
+			t.Fatalf("step %d: op %d on %q: %v\n%s", step, op%4, key, err, trie.Dump())
+		}
+		if trie.Size() != len(oracle) {
+			t.Fatalf("step %d: size %d, want %d", step, trie.Size(), len(oracle))
+		}
+	}
+
+	want := make([]string, 0, len(oracle))
+	for k := range oracle {
+		want = append(want, k)
+	}
+	sort.Strings(want)
+	var got []string
+	trie.Walk(nil, func(key []byte, item *Item) error {
+		if oracle[string(key)] != item {
+			t.Fatalf("key %q holds %v, want %v", key, item, oracle[string(key)])
+		}
+		got = append(got, string(key))
+		return nil
+	})
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("walked %q, want %q", got, want)
+	}
+}
+
+func FuzzTrieOperations(f *testing.F) {
+	rnd := rand.New(rand.NewSource(19))
+	for i := 0; i < 32; i++ {
+		seed := make([]byte, 1+rnd.Intn(600))
+		rnd.Read(seed)
+		f.Add(seed)
+	}
+	f.Fuzz(applyOps)
+}
+
+func TestValidateDetectsDamage(t *testing.T) {
+	newTrie := func() *Trie {
+		trie := newHashTrie(100)
+		if err := trie.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		return trie
+	}
+	cases := map[string]func(trie *Trie){
+		"count":  func(trie *Trie) { trie.count++ },
+		"prefix": func(trie *Trie) { trie.Children.head().Prefix = bytes.Repeat([]byte{1}, 40) },
+		"first byte": func(trie *Trie) {
+			child := trie.Children.head()
+			child.Prefix = append([]byte{child.Prefix[0] + 1}, child.Prefix[1:]...)
+		},
+		"dense count": func(trie *Trie) { trie.Children.(*DenseChildList).NumChildren-- },
+		"empty node": func(trie *Trie) {
+			child := trie.Children.head()
+			child.Item = nil
+			child.Children = newSparseChildList[Item](defaultMaxChildrenPerSparseNode)
+		},
+		"compactable": func(trie *Trie) {
+			// Chain two nodes without items on top of a leaf.
+			leaf := trie.Children.head()
+			wrap := func(prefix []byte, child *Trie) *Trie {
+				return &Trie{Prefix: prefix, cfg: trie.cfg, count: child.count,
+					Children: newSparseChildList[Item](defaultMaxChildrenPerSparseNode).add(child)}
+			}
+			bottom := *leaf
+			bottom.Prefix = leaf.Prefix[2:]
+			*leaf = *wrap(leaf.Prefix[:1], wrap(leaf.Prefix[1:2], &bottom))
+		},
+	}
+	for name, damage := range cases {
+		t.Run(name, func(t *testing.T) {
+			trie := newTrie()
+			damage(trie)
+			if err := trie.Validate(); !errors.Is(err, ErrInvalidTree) {
+				t.Fatalf("want %v, got %v", ErrInvalidTree, err)
+			}
+		})
+	}
+}
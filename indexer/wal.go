@@ -0,0 +1,328 @@
+package indexer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Write-ahead log layout. The log of a header file lives next to it, in a
+// file named after it with walSuffix appended. It is a sequence of records:
+//
+//	length   4 bytes  length of the body
+//	checksum 4 bytes  CRC-32C of the body
+//	body              one or more operations
+//
+// Every operation of a body is
+//
+//	kind     1 byte   batchInsert, batchSet, batchDelete or batchDeleteSubtree
+//	key               length as an unsigned varint, then the key
+//	value             only for batchInsert and batchSet: length as an unsigned
+//	                  varint, then the value encoded by the ValueCodec
+//
+// A record is applied as a whole, so a batch is logged as a single record. A
+// crash while appending leaves a truncated or mismatching last record, which
+// is dropped when the log is replayed.
+//
+// Replaying the log on top of a header file that already holds its
+// operations yields the same trie: Set, Delete and DeleteSubtree overwrite
+// whatever an earlier replay did, and Insert does nothing on keys that exist.
+// A crash between writing a snapshot and truncating the log is thus harmless.
+const (
+	walSuffix       = ".wal"
+	walRecordHeader = 8
+)
+
+// LoggedTrieOf keeps a TrieOf backed by a header file and a write-ahead log.
+// Every mutation is appended to the log and synced to disk before it is
+// applied, and OpenLoggedTrieOf replays the log, so no acknowledged mutation
+// is lost in a crash. Snapshot saves the trie to the header file and empties
+// the log.
+//
+// Mutations return their errors rather than panicking, ErrNilPrefix for a nil
+// key and ErrNilItem for a nil item like BatchOf. It is not thread-safe.
+type LoggedTrieOf[V any] struct {
+	trie     *TrieOf[V]
+	codec    ValueCodec[V]
+	filename string
+	wal      *os.File
+	size     int64 // length of the valid records in the log
+	buf      []byte
+}
+
+// LoggedTrie is the Item based instantiation of LoggedTrieOf.
+type LoggedTrie = LoggedTrieOf[Item]
+
+// OpenLoggedTrie opens the Item trie stored in filename, see
+// OpenLoggedTrieOf.
+func OpenLoggedTrie(filename string, opts ...Option) (*LoggedTrie, error) {
+	return OpenLoggedTrieOf[Item](filename, ItemCodec{}, opts...)
+}
+
+// OpenLoggedTrieOf loads the trie from filename, when it exists, and replays
+// the log next to it, which is created if needed. opts apply to a trie whose
+// header file does not exist yet, otherwise the trie takes the options stored
+// in the file.
+func OpenLoggedTrieOf[V any](filename string, codec ValueCodec[V], opts ...Option) (*LoggedTrieOf[V], error) {
+	if codec == nil {
+		return nil, ErrNoCodec
+	}
+	trie := NewTrieOf(codec, opts...)
+	if err := trie.ReadFromFile(filename); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	wal, err := os.OpenFile(filename+walSuffix, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err == nil {
+		// Make the entry of the new log durable before logging to it.
+		if err = syncDir(filepath.Dir(filename)); err != nil {
+			wal.Close()
+			return nil, err
+		}
+	} else if errors.Is(err, fs.ErrExist) {
+		wal, err = os.OpenFile(filename+walSuffix, os.O_RDWR, 0644)
+	}
+	if err != nil {
+		return nil, err
+	}
+	lt := &LoggedTrieOf[V]{trie: trie, codec: codec, filename: filename, wal: wal}
+	if err := lt.replay(); err != nil {
+		wal.Close()
+		return nil, err
+	}
+	return lt, nil
+}
+
+// replay applies the records of the log to the trie and cuts off a torn last
+// record, leaving the log ready for appending.
+func (lt *LoggedTrieOf[V]) replay() error {
+	info, err := lt.wal.Stat()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(lt.wal)
+	header := make([]byte, walRecordHeader)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return err
+		}
+		n := int64(binary.BigEndian.Uint32(header))
+		if lt.size+walRecordHeader+n > info.Size() {
+			break
+		}
+		body := make([]byte, n)
+		if _, err := io.ReadFull(r, body); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return err
+		}
+		if crc32.Checksum(body, crcTable) != binary.BigEndian.Uint32(header[4:]) {
+			break
+		}
+
+		batch := lt.trie.NewBatch()
+		if err := lt.decodeRecord(batch, body); err != nil {
+			return fmt.Errorf("log record at %d: %w", lt.size, err)
+		}
+		if err := batch.Commit(); err != nil {
+			return fmt.Errorf("log record at %d: %w", lt.size, err)
+		}
+		lt.size += int64(walRecordHeader + len(body))
+	}
+
+	if err := lt.wal.Truncate(lt.size); err != nil {
+		return err
+	}
+	_, err = lt.wal.Seek(lt.size, io.SeekStart)
+	return err
+}
+
+// decodeRecord records the operations of a log record body in batch.
+func (lt *LoggedTrieOf[V]) decodeRecord(batch *BatchOf[V], body []byte) error {
+	next := func() ([]byte, error) {
+		n, size := binary.Uvarint(body)
+		if size <= 0 || n > uint64(len(body)-size) {
+			return nil, fmt.Errorf("%w: bad length in log record", ErrCorrupted)
+		}
+		data := body[size : size+int(n)]
+		body = body[size+int(n):]
+		return data, nil
+	}
+
+	for len(body) != 0 {
+		kind := batchOpKind(body[0])
+		body = body[1:]
+		key, err := next()
+		if err != nil {
+			return err
+		}
+		// The body is not retained, but keys are stored in the trie.
+		key = append([]byte{}, key...)
+
+		switch kind {
+		case batchInsert, batchSet:
+			data, err := next()
+			if err != nil {
+				return err
+			}
+			value, err := lt.codec.DecodeValue(data)
+			if err != nil {
+				return err
+			}
+			batch.record(kind, key, value)
+		case batchDelete, batchDeleteSubtree:
+			batch.record(kind, key, nil)
+		default:
+			return fmt.Errorf("%w: unknown log operation %d", ErrCorrupted, kind)
+		}
+	}
+	return nil
+}
+
+// appendOp appends the encoding of op to a log record body.
+func (lt *LoggedTrieOf[V]) appendOp(dst []byte, op batchOp[V]) []byte {
+	dst = append(dst, byte(op.kind))
+	dst = appendUvarint(dst, uint64(len(op.key)))
+	dst = append(dst, op.key...)
+	if op.kind == batchInsert || op.kind == batchSet {
+		n := len(dst)
+		dst = lt.codec.AppendValue(dst, op.item)
+		value := append([]byte{}, dst[n:]...)
+		dst = appendUvarint(dst[:n], uint64(len(value)))
+		dst = append(dst, value...)
+	}
+	return dst
+}
+
+// log appends a record holding ops to the log and syncs it. On failure the
+// log is cut back to the records before.
+func (lt *LoggedTrieOf[V]) log(ops ...batchOp[V]) error {
+	var header [walRecordHeader]byte
+	buf := append(lt.buf[:0], header[:]...)
+	for _, op := range ops {
+		// Report invalid operations like BatchOf.Commit.
+		if op.key == nil {
+			return ErrNilPrefix
+		}
+		if op.item == nil && (op.kind == batchInsert || op.kind == batchSet) {
+			return ErrNilItem
+		}
+		buf = lt.appendOp(buf, op)
+	}
+	body := buf[walRecordHeader:]
+	binary.BigEndian.PutUint32(buf, uint32(len(body)))
+	binary.BigEndian.PutUint32(buf[4:], crc32.Checksum(body, crcTable))
+	lt.buf = buf
+
+	_, err := lt.wal.Write(buf)
+	if err == nil {
+		err = lt.wal.Sync()
+	}
+	if err != nil {
+		if terr := lt.wal.Truncate(lt.size); terr == nil {
+			lt.wal.Seek(lt.size, io.SeekStart)
+		}
+		return err
+	}
+	lt.size += int64(len(buf))
+	return nil
+}
+
+// Trie returns the logged trie for reading. Modifying it directly bypasses
+// the log.
+func (lt *LoggedTrieOf[V]) Trie() *TrieOf[V] {
+	return lt.trie
+}
+
+func (lt *LoggedTrieOf[V]) Get(key []byte) *V {
+	return lt.trie.Get(key)
+}
+
+// Insert logs and applies TrieOf.Insert.
+func (lt *LoggedTrieOf[V]) Insert(key []byte, item *V) (inserted bool, err error) {
+	if err := lt.log(batchOp[V]{kind: batchInsert, key: key, item: item}); err != nil {
+		return false, err
+	}
+	return lt.trie.Insert(key, item), nil
+}
+
+// Set logs and applies TrieOf.Set.
+func (lt *LoggedTrieOf[V]) Set(key []byte, item *V) error {
+	if err := lt.log(batchOp[V]{kind: batchSet, key: key, item: item}); err != nil {
+		return err
+	}
+	lt.trie.Set(key, item)
+	return nil
+}
+
+// Delete logs and applies TrieOf.Delete.
+func (lt *LoggedTrieOf[V]) Delete(key []byte) (deleted bool, err error) {
+	if err := lt.log(batchOp[V]{kind: batchDelete, key: key}); err != nil {
+		return false, err
+	}
+	return lt.trie.Delete(key), nil
+}
+
+// DeleteSubtree logs and applies TrieOf.DeleteSubtree.
+func (lt *LoggedTrieOf[V]) DeleteSubtree(prefix []byte) (deleted bool, err error) {
+	if err := lt.log(batchOp[V]{kind: batchDeleteSubtree, key: prefix}); err != nil {
+		return false, err
+	}
+	return lt.trie.DeleteSubtree(prefix), nil
+}
+
+// NewBatch returns an empty batch for the logged trie, to be applied with
+// Commit.
+func (lt *LoggedTrieOf[V]) NewBatch() *BatchOf[V] {
+	return lt.trie.NewBatch()
+}
+
+// Commit logs the operations of batch as a single record and commits it. As
+// with BatchOf.Commit, the batch is empty afterwards and neither the trie nor
+// the log change when it fails.
+func (lt *LoggedTrieOf[V]) Commit(batch *BatchOf[V]) error {
+	if batch.trie != lt.trie {
+		batch.Rollback()
+		return ErrForeignBatch
+	}
+	if batch.err == nil && len(batch.ops) != 0 {
+		if err := lt.log(batch.ops...); err != nil {
+			batch.Rollback()
+			return err
+		}
+	}
+	return batch.Commit()
+}
+
+// Snapshot saves the trie to the header file with opts and empties the log.
+func (lt *LoggedTrieOf[V]) Snapshot(opts ...SaveOption) error {
+	if err := lt.trie.SaveToFile(lt.filename, opts...); err != nil {
+		return err
+	}
+	if err := lt.wal.Truncate(0); err != nil {
+		return err
+	}
+	lt.size = 0
+	if _, err := lt.wal.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return lt.wal.Sync()
+}
+
+// Close closes the log. Mutations are durable already, Close does not write
+// a snapshot.
+func (lt *LoggedTrieOf[V]) Close() error {
+	return lt.wal.Close()
+}
+
+var ErrForeignBatch = errors.New("batch belongs to another trie")
@@ -0,0 +1,206 @@
+package indexer
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// reopen closes lt and opens its files again with opts.
+func reopen(t *testing.T, lt *LoggedTrie, opts ...Option) *LoggedTrie {
+	t.Helper()
+	if err := lt.Close(); err != nil {
+		t.Fatal(err)
+	}
+	lt, err := OpenLoggedTrie(lt.filename, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lt
+}
+
+func walSize(t *testing.T, filename string) int64 {
+	t.Helper()
+	info, err := os.Stat(filename + walSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestLoggedTrieReplay(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "h1")
+	lt, err := OpenLoggedTrie(filename, WithMaxPrefixPerNode(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := NewTrie(WithMaxPrefixPerNode(4))
+
+	rnd := rand.New(rand.NewSource(24))
+	for round := 0; round < 4; round++ {
+		for i := 0; i < 200; i++ {
+			key := make([]byte, rnd.Intn(8))
+			for j := range key {
+				key[j] = 'a' + byte(rnd.Intn(4))
+			}
+			item := &Item{Pos: uint64(round*1000 + i)}
+			switch rnd.Intn(6) {
+			case 0, 1:
+				inserted, err := lt.Insert(key, item)
+				if err != nil || inserted != want.Insert(key, item) {
+					t.Fatalf("insert %q: %v", key, err)
+				}
+			case 2, 3:
+				if err := lt.Set(key, item); err != nil {
+					t.Fatal(err)
+				}
+				want.Set(key, item)
+			case 4:
+				deleted, err := lt.Delete(key)
+				if err != nil || deleted != want.Delete(key) {
+					t.Fatalf("delete %q: %v", key, err)
+				}
+			case 5:
+				deleted, err := lt.DeleteSubtree(key)
+				if err != nil || deleted != want.DeleteSubtree(key) {
+					t.Fatalf("delete subtree %q: %v", key, err)
+				}
+			}
+		}
+
+		// Every other round is saved before reopening, the rest is
+		// replayed from the log alone.
+		if round%2 == 1 {
+			if err := lt.Snapshot(); err != nil {
+				t.Fatal(err)
+			}
+			if n := walSize(t, filename); n != 0 {
+				t.Fatalf("log holds %d bytes after a snapshot", n)
+			}
+		}
+		lt = reopen(t, lt, WithMaxPrefixPerNode(4))
+		assertSameItems(t, want, lt.Trie())
+		assertShape(t, lt.Trie(), 4, defaultMaxChildrenPerSparseNode)
+	}
+	lt.Close()
+}
+
+func TestLoggedTrieTornRecord(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "h1")
+	lt, err := OpenLoggedTrie(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt.Set([]byte("a"), &Item{Pos: 1})
+	lt.Set([]byte("b"), &Item{Pos: 2})
+	good := walSize(t, filename)
+	lt.Set([]byte("c"), &Item{Pos: 3})
+	full := walSize(t, filename)
+	lt.Close()
+
+	damage := map[string]func(data []byte) []byte{
+		"truncated": func(data []byte) []byte { return data[:len(data)-3] },
+		"header":    func(data []byte) []byte { return data[:good+5] },
+		"checksum":  func(data []byte) []byte { data[len(data)-1]++; return data },
+		"length":    func(data []byte) []byte { data[good] = 0xff; return data },
+	}
+	for name, damage := range damage {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(filename + walSuffix)
+			if err != nil || int64(len(data)) != full {
+				t.Fatalf("log of %d bytes: %v", len(data), err)
+			}
+			name := filepath.Join(t.TempDir(), "h1")
+			if err := os.WriteFile(name+walSuffix, damage(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			lt, err := OpenLoggedTrie(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { lt.Close() }()
+			if lt.Get([]byte("b")) == nil || lt.Get([]byte("c")) != nil {
+				t.Fatalf("replayed %s", lt.Trie().Dump())
+			}
+			if n := walSize(t, name); n != good {
+				t.Fatalf("log of %d bytes, want %d", n, good)
+			}
+
+			// Appending continues after the last intact record.
+			lt.Set([]byte("d"), &Item{Pos: 4})
+			lt = reopen(t, lt)
+			if lt.Get([]byte("d")) == nil || lt.Trie().Size() != 3 {
+				t.Fatalf("replayed %s", lt.Trie().Dump())
+			}
+		})
+	}
+}
+
+func TestLoggedTrieCommit(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "h1")
+	lt, err := OpenLoggedTrie(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		lt.Set([]byte{'a', byte(i)}, &Item{Pos: uint64(i)})
+	}
+	if err := lt.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := lt.NewBatch()
+	b.DeleteSubtree([]byte("a"))
+	b.Set([]byte("b"), &Item{Pos: 1})
+	b.Insert([]byte("b"), &Item{Pos: 2})
+	if err := lt.Commit(b); err != nil {
+		t.Fatal(err)
+	}
+
+	// Invalid and foreign batches are neither logged nor applied.
+	size := walSize(t, filename)
+	b.Set([]byte("c"), &Item{})
+	b.Delete(nil)
+	if err := lt.Commit(b); !errors.Is(err, ErrNilPrefix) {
+		t.Fatalf("want %v, got %v", ErrNilPrefix, err)
+	}
+	foreign := NewTrie().NewBatch()
+	foreign.Set([]byte("c"), &Item{})
+	if err := lt.Commit(foreign); err != ErrForeignBatch {
+		t.Fatalf("want %v, got %v", ErrForeignBatch, err)
+	}
+	if walSize(t, filename) != size || lt.Get([]byte("c")) != nil {
+		t.Fatal("failed commit was logged")
+	}
+
+	lt = reopen(t, lt)
+	defer lt.Close()
+	if lt.Trie().Size() != 1 || lt.Get([]byte("b")).Pos != 1 {
+		t.Fatalf("replayed %s", lt.Trie().Dump())
+	}
+}
+
+func TestLoggedTrieInvalid(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "h1")
+	lt, err := OpenLoggedTrie(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lt.Close()
+
+	if err := lt.Set(nil, &Item{}); err != ErrNilPrefix {
+		t.Fatalf("set nil key: want %v, got %v", ErrNilPrefix, err)
+	}
+	if _, err := lt.Delete(nil); err != ErrNilPrefix {
+		t.Fatalf("delete nil key: want %v, got %v", ErrNilPrefix, err)
+	}
+	if _, err := lt.Insert([]byte("a"), nil); err != ErrNilItem {
+		t.Fatalf("insert nil item: want %v, got %v", ErrNilItem, err)
+	}
+	if n := walSize(t, filename); n != 0 || !lt.Trie().Empty() {
+		t.Fatalf("invalid mutations logged %d bytes", n)
+	}
+}
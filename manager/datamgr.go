@@ -48,15 +48,16 @@ func (mgr *DataNodeMgr) Get(blockNum string) (*DataNode, error) {
 		return nil, err
 	}
 	dn.Reader = ra
+	bp.Reset()
 	bp.WriteString(mgr.dataPath)
 	bp.WriteString("/h")
 	bp.WriteString(blockNum)
-	trie := indexer.NewTrie()
-	err = trie.ReadFromFile(bp.String())
+	header, err := indexer.OpenLookup(bp.String())
 	if err != nil {
+		ra.Close()
 		return nil, err
 	}
-	dn.Header = trie
+	dn.Header = header
 	dn.Name = blockNum
 	mgr.cache.Add(blockNum, dn)
 	return dn, nil
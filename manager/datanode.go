@@ -2,7 +2,9 @@ package manager
 
 import (
 	"crypto/sha256"
+	"errors"
 	"hash"
+	"io"
 	"sync"
 
 	"github.com/Ankr-network/storagechain-lib/indexer"
@@ -17,10 +19,14 @@ var (
 	}
 )
 
+var ErrNotFound = errors.New("key not found")
+
 type DataNode struct {
 	Name   string
 	Reader *mmap.ReaderAt
-	Header *indexer.Trie
+	// Header is either an *indexer.Index mapped from the h<num> file or an
+	// *indexer.Trie loaded from it.
+	Header indexer.Lookup
 }
 
 func (dn *DataNode) Get(key string) ([]byte, error) {
@@ -29,7 +35,27 @@ func (dn *DataNode) Get(key string) ([]byte, error) {
 	hasher.Reset()
 	hasher.Write(indexer.Froms(key))
 	item := dn.Header.Get(hasher.Sum(nil))
+	if item == nil {
+		return nil, ErrNotFound
+	}
 	rs := make([]byte, item.Length)
 	dn.Reader.ReadAt(rs, int64(item.Pos))
 	return rs, nil
 }
+
+// Root returns the Merkle root of the block header, which identifies the
+// contents of the block across nodes.
+func (dn *DataNode) Root() ([]byte, error) {
+	return dn.Header.Root()
+}
+
+// Close unmaps the data file and, for index headers, the header file.
+func (dn *DataNode) Close() error {
+	err := dn.Reader.Close()
+	if c, ok := dn.Header.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}